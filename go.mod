@@ -6,9 +6,7 @@ require (
 	github.com/boot-go/boot v1.1.0
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/piquette/finance-go v1.1.0
+	github.com/shopspring/decimal v1.3.1
 )
 
-require (
-	github.com/shopspring/decimal v1.3.1 // indirect
-	github.com/stretchr/testify v1.8.1 // indirect
-)
+require github.com/stretchr/testify v1.8.1 // indirect
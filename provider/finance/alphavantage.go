@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrMissingAPIKey is returned, when the Alpha Vantage backend is selected without API key.
+var ErrMissingAPIKey = errors.New("missing api key")
+
+// alphaVantageSource provides quotes of the GLOBAL_QUOTE function of Alpha Vantage. The function
+// doesn't report the currency, so amounts are without currency.
+type alphaVantageSource struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewAlphaVantageSource creates the quote source backed by Alpha Vantage. The base URL can be
+// changed for testing, e.g. to the fake backend of financetest.
+func NewAlphaVantageSource(apiKey, baseURL string, client *http.Client) (QuoteSource, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("alphavantage: %w", ErrMissingAPIKey)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &alphaVantageSource{
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+	}, nil
+}
+
+// alphaVantageResponse is the response of GLOBAL_QUOTE. Errors and rate limits are reported with
+// status 200 and a message.
+type alphaVantageResponse struct {
+	GlobalQuote  map[string]string `json:"Global Quote"`
+	ErrorMessage string            `json:"Error Message"`
+	Note         string            `json:"Note"`
+	Information  string            `json:"Information"`
+}
+
+func (a *alphaVantageSource) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	query := url.Values{}
+	query.Set("function", "GLOBAL_QUOTE")
+	query.Set("symbol", symbol)
+	query.Set("apikey", a.apiKey)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+"/query?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if requestID := RequestID(ctx); requestID != "" {
+		request.Header.Set("X-Request-Id", requestID)
+	}
+	response, err := a.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("alphavantage: %w", statusError(response))
+	}
+	var result alphaVantageResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("alphavantage: %w", err)
+	}
+	switch {
+	case result.ErrorMessage != "":
+		return nil, fmt.Errorf("alphavantage: %s", result.ErrorMessage)
+	case result.Note != "":
+		return nil, fmt.Errorf("alphavantage: %w", alphaVantageMessage(result.Note))
+	case result.Information != "":
+		return nil, fmt.Errorf("alphavantage: %w", alphaVantageMessage(result.Information))
+	case len(result.GlobalQuote) == 0:
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	}
+	return fromAlphaVantageQuote(result.GlobalQuote)
+}
+
+// alphaVantageMessage returns the error of a note or information. Messages about the call
+// frequency or the rate limit are reported as ErrRateLimited.
+func alphaVantageMessage(message string) error {
+	lower := strings.ToLower(message)
+	if strings.Contains(lower, "rate limit") || strings.Contains(lower, "call frequency") {
+		return &BackendError{Kind: ErrRateLimited, Err: errors.New(message)}
+	}
+	return errors.New(message)
+}
+
+// fromAlphaVantageQuote converts the numbered fields of GLOBAL_QUOTE, e.g. "05. price".
+func fromAlphaVantageQuote(fields map[string]string) (*Quote, error) {
+	var err error
+	number := func(key string) decimal.Decimal {
+		value := strings.TrimSuffix(fields[key], "%")
+		if value == "" || err != nil {
+			return decimal.Zero
+		}
+		var parsed decimal.Decimal
+		parsed, err = decimal.NewFromString(value)
+		if err != nil {
+			err = fmt.Errorf("alphavantage: invalid %s: %w", key, err)
+		}
+		return parsed
+	}
+	money := func(key string) Money {
+		return NewMoney(number(key), "")
+	}
+	quote := &Quote{
+		Instrument: Instrument{
+			Symbol: fields["01. symbol"],
+		},
+		Open:          money("02. open"),
+		High:          money("03. high"),
+		Low:           money("04. low"),
+		Price:         money("05. price"),
+		Volume:        number("06. volume").IntPart(),
+		PreviousClose: money("08. previous close"),
+		Change:        number("09. change"),
+		ChangePercent: number("10. change percent"),
+		Source:        "alphavantage",
+	}
+	if err != nil {
+		return nil, err
+	}
+	if day, parseErr := time.Parse(time.DateOnly, fields["07. latest trading day"]); parseErr == nil {
+		quote.Time = day
+	}
+	return quote, nil
+}
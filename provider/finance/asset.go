@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrAssetClassMismatch is returned by typed lookups, when the symbol belongs to another asset
+// class, e.g. an etf requested as equity.
+var ErrAssetClassMismatch = errors.New("symbol belongs to another asset class")
+
+// Asset is the class-specific quote of an instrument, e.g. *EquityQuote or *FundQuote. Indices
+// have no specific fields and are a plain *Quote.
+type Asset interface {
+	Common() *Quote
+}
+
+// Common returns the fields shared by all asset classes.
+func (q *Quote) Common() *Quote {
+	return q
+}
+
+// EquityQuote is the quote of a stock with its fundamentals.
+type EquityQuote struct {
+	Quote
+	EPS               decimal.Decimal `json:"eps" xml:"eps" csv:"eps"`
+	ForwardEPS        decimal.Decimal `json:"forwardEps" xml:"forwardEps" csv:"forwardEps"`
+	PE                decimal.Decimal `json:"pe" xml:"pe" csv:"pe"`
+	ForwardPE         decimal.Decimal `json:"forwardPe" xml:"forwardPe" csv:"forwardPe"`
+	DividendRate      Money           `json:"dividendRate" xml:"dividendRate" csv:"dividendRate"`
+	DividendYield     decimal.Decimal `json:"dividendYield" xml:"dividendYield" csv:"dividendYield"`
+	BookValue         Money           `json:"bookValue" xml:"bookValue" csv:"bookValue"`
+	PriceToBook       decimal.Decimal `json:"priceToBook" xml:"priceToBook" csv:"priceToBook"`
+	SharesOutstanding int64           `json:"sharesOutstanding" xml:"sharesOutstanding" csv:"sharesOutstanding"`
+	MarketCap         Money           `json:"marketCap" xml:"marketCap" csv:"marketCap"`
+	EarningsDate      time.Time       `json:"earningsDate" xml:"earningsDate" csv:"earningsDate"`
+}
+
+// FundQuote is the quote of an etf or a mutual fund. The returns are in percent.
+type FundQuote struct {
+	Quote
+	NAV                 Money           `json:"nav" xml:"nav" csv:"nav"`
+	YTDReturn           decimal.Decimal `json:"ytdReturn" xml:"ytdReturn" csv:"ytdReturn"`
+	ThreeMonthReturn    decimal.Decimal `json:"threeMonthReturn" xml:"threeMonthReturn" csv:"threeMonthReturn"`
+	ThreeMonthNAVReturn decimal.Decimal `json:"threeMonthNavReturn" xml:"threeMonthNavReturn" csv:"threeMonthNavReturn"`
+	TotalAssets         Money           `json:"totalAssets" xml:"totalAssets" csv:"totalAssets"`
+}
+
+// CurrencyPairQuote is the quote of a forex pair. The price is the amount of the quote currency
+// for one unit of the base currency.
+type CurrencyPairQuote struct {
+	Quote
+	BaseCurrency  string `json:"baseCurrency" xml:"baseCurrency" csv:"baseCurrency"`
+	QuoteCurrency string `json:"quoteCurrency" xml:"quoteCurrency" csv:"quoteCurrency"`
+}
+
+// CryptoQuote is the quote of a crypto currency pair.
+type CryptoQuote struct {
+	Quote
+	BaseCurrency      string `json:"baseCurrency" xml:"baseCurrency" csv:"baseCurrency"`
+	QuoteCurrency     string `json:"quoteCurrency" xml:"quoteCurrency" csv:"quoteCurrency"`
+	CirculatingSupply int64  `json:"circulatingSupply" xml:"circulatingSupply" csv:"circulatingSupply"`
+	MaxSupply         int64  `json:"maxSupply" xml:"maxSupply" csv:"maxSupply"`
+	Volume24h         int64  `json:"volume24h" xml:"volume24h" csv:"volume24h"`
+	MarketCap         Money  `json:"marketCap" xml:"marketCap" csv:"marketCap"`
+}
+
+// FutureQuote is the quote of a futures contract.
+type FutureQuote struct {
+	Quote
+	Underlying   string    `json:"underlying" xml:"underlying" csv:"underlying"`
+	OpenInterest int64     `json:"openInterest" xml:"openInterest" csv:"openInterest"`
+	Expiration   time.Time `json:"expiration" xml:"expiration" csv:"expiration"`
+}
+
+// OptionQuote is the quote of an option contract.
+type OptionQuote struct {
+	Quote
+	Underlying   string    `json:"underlying" xml:"underlying" csv:"underlying"`
+	OpenInterest int64     `json:"openInterest" xml:"openInterest" csv:"openInterest"`
+	Expiration   time.Time `json:"expiration" xml:"expiration" csv:"expiration"`
+	Strike       Money     `json:"strike" xml:"strike" csv:"strike"`
+}
+
+// AssetSource is a backend providing class-specific quotes. Backends without this interface
+// provide the plain quote, which contains the asset class if the backend knows it.
+type AssetSource interface {
+	Asset(ctx context.Context, symbol string) (Asset, error)
+}
+
+// lookupAsset returns the asset of the symbol as class-specific quote of the expected classes.
+func lookupAsset[T Asset](ctx context.Context, f *failover, symbol string, classes ...InstrumentType) (T, error) {
+	var zero T
+	asset, err := f.Asset(ctx, symbol)
+	if err != nil {
+		return zero, err
+	}
+	class := asset.Common().Type
+	typed, ok := asset.(T)
+	if ok {
+		ok = false
+		for _, expected := range classes {
+			ok = ok || class == expected
+		}
+	}
+	if !ok {
+		if class == "" {
+			class = "unknown"
+		}
+		return zero, fmt.Errorf("%w: %s is %s, expected %v", ErrAssetClassMismatch, symbol, class, classes)
+	}
+	return typed, nil
+}
@@ -0,0 +1,474 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boot-go/boot"
+)
+
+var (
+	// ErrSymbolNotFound is returned, when no backend knows the symbol.
+	ErrSymbolNotFound = errors.New("symbol not found")
+	// ErrNoBackendAvailable is returned, when all backends failed or their circuit is open.
+	ErrNoBackendAvailable = errors.New("no market data backend available")
+	// ErrUnknownBackend is returned, when a configured backend isn't registered.
+	ErrUnknownBackend = errors.New("unknown market data backend")
+	// ErrNotSupported is returned, when none of the configured backends supports the operation.
+	ErrNotSupported = errors.New("operation not supported by the configured backends")
+	errCircuitOpen  = fmt.Errorf("circuit is open: %w", ErrUpstreamUnavailable)
+)
+
+// BackendFactory creates a backend. It is called once when the finance component is initialized.
+type BackendFactory func() (QuoteSource, error)
+
+// backendFactories contains the backends registered by other packages.
+var backendFactories = struct {
+	sync.RWMutex
+	factories map[string]BackendFactory
+}{factories: make(map[string]BackendFactory)}
+
+// RegisterBackend registers a backend, which can be selected with FINANCE_PROVIDERS. A registered
+// backend replaces a built-in backend with the same name.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendFactories.Lock()
+	defer backendFactories.Unlock()
+	backendFactories.factories[strings.ToLower(name)] = factory
+}
+
+func registeredBackend(name string) (BackendFactory, bool) {
+	backendFactories.RLock()
+	defer backendFactories.RUnlock()
+	factory, ok := backendFactories.factories[name]
+	return factory, ok
+}
+
+// BreakerState is the state of the circuit breaker of a backend.
+type BreakerState int
+
+const (
+	// BreakerClosed passes all requests to the backend.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen skips the backend until the cooldown is over.
+	BreakerOpen
+	// BreakerHalfOpen passes a single trial request to the backend.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// BackendHealth reports the health of a backend.
+type BackendHealth struct {
+	Name                string       `json:"name"`
+	Priority            int          `json:"priority"`
+	State               BreakerState `json:"state"`
+	Successes           uint64       `json:"successes"`
+	Failures            uint64       `json:"failures"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	LastError           string       `json:"lastError,omitempty"`
+	LastSuccess         time.Time    `json:"lastSuccess"`
+	LastFailure         time.Time    `json:"lastFailure"`
+}
+
+// backend wraps a source with health tracking and a circuit breaker.
+type backend struct {
+	name      string
+	source    QuoteSource
+	threshold int
+	cooldown  time.Duration
+	limiter   *limiter
+	mutex     sync.Mutex
+	health    BackendHealth
+	openedAt  time.Time
+	trial     bool
+}
+
+// allow returns true, if the backend may be called. An open circuit turns half-open after the
+// cooldown and lets a single trial request pass.
+func (b *backend) allow(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.health.State {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.health.State = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *backend) succeeded(now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.health.Successes++
+	b.health.ConsecutiveFailures = 0
+	b.health.LastSuccess = now
+	b.health.State = BreakerClosed
+	b.trial = false
+}
+
+func (b *backend) failed(now time.Time, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.health.Failures++
+	b.health.ConsecutiveFailures++
+	b.health.LastError = err.Error()
+	b.health.LastFailure = now
+	b.trial = false
+	if b.health.State == BreakerHalfOpen || b.health.ConsecutiveFailures >= b.threshold {
+		if b.health.State != BreakerOpen {
+			boot.Logger.Warn.Printf("circuit of market data backend %s opened: %v", b.name, err)
+		}
+		b.health.State = BreakerOpen
+		b.openedAt = now
+	}
+}
+
+// released resets a trial, which neither succeeded nor failed, e.g. when the caller canceled.
+func (b *backend) released() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.trial = false
+}
+
+func (b *backend) snapshot() BackendHealth {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.health
+}
+
+// failover asks the backends in the order of their priority until one returns a quote.
+type failover struct {
+	backends    []*backend
+	concurrency int
+	retry       retryPolicy
+	now         func() time.Time
+}
+
+func newFailover(names []string, sources []QuoteSource, threshold int, cooldown time.Duration, concurrency int) *failover {
+	if threshold < 1 {
+		threshold = 1
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	f := &failover{now: time.Now, concurrency: concurrency, retry: retryPolicy{attempts: 1}}
+	for i, source := range sources {
+		f.backends = append(f.backends, &backend{
+			name:      names[i],
+			source:    source,
+			threshold: threshold,
+			cooldown:  cooldown,
+			health:    BackendHealth{Name: names[i], Priority: i},
+		})
+	}
+	return f
+}
+
+func (f *failover) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	return call(ctx, f, symbol, nil, func(source QuoteSource) (*Quote, error) {
+		return source.Quote(ctx, symbol)
+	})
+}
+
+func (f *failover) Bars(ctx context.Context, symbol string, interval Interval, from, to time.Time) (*Chart, error) {
+	if err := validateBars(interval, from, to); err != nil {
+		return nil, err
+	}
+	supports := func(source QuoteSource) bool {
+		_, ok := source.(BarSource)
+		return ok
+	}
+	return call(ctx, f, symbol, supports, func(source QuoteSource) (*Chart, error) {
+		return source.(BarSource).Bars(ctx, symbol, interval, from, to)
+	})
+}
+
+// Asset returns the class-specific quote of backends implementing AssetSource or the plain quote
+// of the other backends.
+func (f *failover) Asset(ctx context.Context, symbol string) (Asset, error) {
+	return call(ctx, f, symbol, nil, func(source QuoteSource) (Asset, error) {
+		if assets, ok := source.(AssetSource); ok {
+			return assets.Asset(ctx, symbol)
+		}
+		return source.Quote(ctx, symbol)
+	})
+}
+
+func supportsOptions(source QuoteSource) bool {
+	_, ok := source.(OptionSource)
+	return ok
+}
+
+func (f *failover) Expirations(ctx context.Context, underlying string) ([]time.Time, error) {
+	return call(ctx, f, underlying, supportsOptions, func(source QuoteSource) ([]time.Time, error) {
+		return source.(OptionSource).Expirations(ctx, underlying)
+	})
+}
+
+func (f *failover) OptionChain(ctx context.Context, underlying string, expiry time.Time) (*OptionChain, error) {
+	return call(ctx, f, underlying, supportsOptions, func(source QuoteSource) (*OptionChain, error) {
+		return source.(OptionSource).OptionChain(ctx, underlying, expirationDate(expiry))
+	})
+}
+
+// call asks the backends supporting the operation in the order of their priority until one
+// succeeds. All backends are supported, when supports is nil.
+func call[T any](ctx context.Context, f *failover, symbol string, supports func(QuoteSource) bool, do func(QuoteSource) (T, error)) (T, error) {
+	var zero T
+	var errs []error
+	notFound := false
+	supported := false
+	for _, b := range f.backends {
+		if supports != nil && !supports(b.source) {
+			continue
+		}
+		supported = true
+		if !b.allow(f.now()) {
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, errCircuitOpen))
+			continue
+		}
+		result, err := attempt(ctx, f, b, func() (T, error) {
+			return do(b.source)
+		})
+		switch {
+		case err == nil:
+			b.succeeded(f.now())
+			return result, nil
+		case ctx.Err() != nil:
+			b.released()
+			return zero, ctx.Err()
+		case errors.Is(err, errDailyLimit):
+			// the backend wasn't asked, so its health is unchanged
+			b.released()
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, err))
+		case errors.Is(err, ErrSymbolNotFound):
+			// the backend works, it just doesn't know the symbol
+			b.succeeded(f.now())
+			notFound = true
+		default:
+			b.failed(f.now(), err)
+			boot.Logger.Warn.Printf("market data backend %s failed for %s: %v%s", b.name, symbol, err, requestSuffix(ctx))
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, err))
+		}
+	}
+	if !supported {
+		return zero, ErrNotSupported
+	}
+	// unknown only if no backend, which might know the symbol, failed
+	if notFound && len(errs) == 0 {
+		return zero, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	}
+	return zero, fmt.Errorf("%w: %w", ErrNoBackendAvailable, errors.Join(errs...))
+}
+
+// Quotes fetches the symbols in chunks of the upstream batch size. The chunks of a backend run in
+// parallel, symbols of failed chunks are passed on to the next backend. The results are in the
+// order of the symbols without duplicates.
+func (f *failover) Quotes(ctx context.Context, symbols []string) ([]QuoteResult, error) {
+	unique := uniqueSymbols(symbols)
+	state := &batchState{
+		quotes: make(map[string]*Quote, len(unique)),
+		errs:   make(map[string][]error),
+	}
+	pending := unique
+	for _, b := range f.backends {
+		if len(pending) == 0 || ctx.Err() != nil {
+			break
+		}
+		f.fetch(ctx, b, pending, state)
+		pending = pending[:0:0]
+		for _, symbol := range unique {
+			if state.quotes[strings.ToUpper(symbol)] == nil {
+				pending = append(pending, symbol)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	results := make([]QuoteResult, 0, len(unique))
+	for _, symbol := range unique {
+		key := strings.ToUpper(symbol)
+		result := QuoteResult{Symbol: symbol, Quote: state.quotes[key]}
+		switch {
+		case result.Quote != nil:
+		case len(state.errs[key]) == 0:
+			result.Err = fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+		default:
+			result.Err = fmt.Errorf("%w: %w", ErrNoBackendAvailable, errors.Join(state.errs[key]...))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// uniqueSymbols removes empty and duplicate symbols, the case of the symbols is ignored.
+func uniqueSymbols(symbols []string) []string {
+	var unique []string
+	seen := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		key := strings.ToUpper(symbol)
+		if !seen[key] && symbol != "" {
+			seen[key] = true
+			unique = append(unique, symbol)
+		}
+	}
+	return unique
+}
+
+// batchState collects the results of the chunks, which run in parallel. Symbols without quote
+// and without errors are unknown to all backends.
+type batchState struct {
+	mutex  sync.Mutex
+	quotes map[string]*Quote
+	errs   map[string][]error
+}
+
+func (state *batchState) fail(symbols []string, err error) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	for _, symbol := range symbols {
+		key := strings.ToUpper(symbol)
+		state.errs[key] = append(state.errs[key], err)
+	}
+}
+
+// fetch requests the symbols of the backend in chunks with bounded concurrency.
+func (f *failover) fetch(ctx context.Context, b *backend, symbols []string, state *batchState) {
+	size := 1
+	batch, isBatch := b.source.(BatchQuoteSource)
+	if isBatch {
+		size = batch.BatchSize()
+	}
+	semaphore := make(chan struct{}, f.concurrency)
+	var wg sync.WaitGroup
+	for _, symbols := range chunk(symbols, size) {
+		if !b.allow(f.now()) {
+			state.fail(symbols, fmt.Errorf("%s: %w", b.name, errCircuitOpen))
+			continue
+		}
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			b.released()
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(symbols []string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			quotes, err := attempt(ctx, f, b, func() (map[string]*Quote, error) {
+				if isBatch {
+					return batch.Quotes(ctx, symbols)
+				}
+				quote, err := b.source.Quote(ctx, symbols[0])
+				switch {
+				case err == nil:
+					return map[string]*Quote{strings.ToUpper(symbols[0]): quote}, nil
+				case errors.Is(err, ErrSymbolNotFound):
+					return map[string]*Quote{}, nil
+				default:
+					return nil, err
+				}
+			})
+			switch {
+			case err == nil:
+				b.succeeded(f.now())
+			case ctx.Err() != nil:
+				b.released()
+				return
+			case errors.Is(err, errDailyLimit):
+				b.released()
+				state.fail(symbols, fmt.Errorf("%s: %w", b.name, err))
+				return
+			default:
+				b.failed(f.now(), err)
+				boot.Logger.Warn.Printf("market data backend %s failed for %d symbols: %v%s", b.name, len(symbols), err, requestSuffix(ctx))
+				state.fail(symbols, fmt.Errorf("%s: %w", b.name, err))
+				return
+			}
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			for _, symbol := range symbols {
+				if quote := quotes[strings.ToUpper(symbol)]; quote != nil {
+					state.quotes[strings.ToUpper(symbol)] = quote
+				}
+			}
+		}(symbols)
+	}
+	wg.Wait()
+}
+
+// limit sets the client-side rate limit of the backend. False is returned, when the backend isn't
+// configured.
+func (f *failover) limit(name string, limit RateLimit) bool {
+	found := false
+	for _, b := range f.backends {
+		if b.name == name {
+			b.limiter = newLimiter(limit)
+			found = true
+		}
+	}
+	return found
+}
+
+// health returns the health of all backends in the order of their priority.
+func (f *failover) health() []BackendHealth {
+	result := make([]BackendHealth, 0, len(f.backends))
+	for _, b := range f.backends {
+		result = append(result, b.snapshot())
+	}
+	return result
+}
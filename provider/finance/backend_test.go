@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boot-go/stack/provider/finance"
+	"github.com/boot-go/stack/provider/finance/financetest"
+)
+
+// clock is a manually advanced clock of the circuit breakers.
+type clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newFailover creates a failover of the fake backends named primary and secondary.
+func newFailover(t *testing.T, threshold int, cooldown time.Duration) (*finance.Failover, *financetest.Backend, *financetest.Backend, *clock) {
+	t.Helper()
+	primary, secondary := financetest.NewBackend(t), financetest.NewBackend(t)
+	f := finance.NewFailover([]string{"primary", "secondary"}, []finance.QuoteSource{primary.Source(), secondary.Source()}, threshold, cooldown, 2)
+	c := &clock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	f.SetClock(c.Now)
+	return f, primary, secondary, c
+}
+
+// price returns the price of the quote of the symbol.
+func price(t *testing.T, f *finance.Failover, symbol string) string {
+	t.Helper()
+	quote, err := f.Quote(context.Background(), symbol)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return quote.Price.Amount.String()
+}
+
+func TestFailoverOrder(t *testing.T) {
+	f, primary, secondary, _ := newFailover(t, 5, time.Minute)
+	primary.SetQuote("ACME", "1")
+	secondary.SetQuote("ACME", "2")
+	if got := price(t, f, "ACME"); got != "1" || secondary.Requests() != 0 {
+		t.Errorf("expected the quote of the primary backend only, got %s after %d secondary requests", got, secondary.Requests())
+	}
+	primary.Fail(http.StatusServiceUnavailable)
+	if got := price(t, f, "ACME"); got != "2" {
+		t.Errorf("expected the quote of the secondary backend, got %s", got)
+	}
+	health := f.Health()
+	if health[0].Failures != 1 || health[0].LastError == "" || health[1].Successes != 1 {
+		t.Errorf("unexpected health %+v", health)
+	}
+}
+
+func TestFailoverErrors(t *testing.T) {
+	f, primary, secondary, _ := newFailover(t, 5, time.Minute)
+	if _, err := f.Quote(context.Background(), "UNKNOWN"); !errors.Is(err, finance.ErrSymbolNotFound) {
+		t.Errorf("expected ErrSymbolNotFound, got %v", err)
+	}
+	if primary.Requests() != 1 || secondary.Requests() != 1 {
+		t.Errorf("expected all backends to be asked for an unknown symbol")
+	}
+	primary.Fail(http.StatusBadGateway)
+	if _, err := f.Quote(context.Background(), "UNKNOWN"); !errors.Is(err, finance.ErrNoBackendAvailable) || errors.Is(err, finance.ErrSymbolNotFound) {
+		t.Errorf("expected ErrNoBackendAvailable, when a backend, which might know the symbol, failed, got %v", err)
+	}
+	secondary.Fail(http.StatusServiceUnavailable)
+	_, err := f.Quote(context.Background(), "ACME")
+	if !errors.Is(err, finance.ErrNoBackendAvailable) || !errors.Is(err, finance.ErrUpstreamUnavailable) {
+		t.Errorf("expected ErrNoBackendAvailable wrapping the upstream errors, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "primary") || !strings.Contains(err.Error(), "secondary") {
+		t.Errorf("expected the errors of all backends, got %v", err)
+	}
+	if _, err := f.Bars(context.Background(), "ACME", finance.OneDay, time.Time{}, time.Time{}); !errors.Is(err, finance.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported for bars, got %v", err)
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	f, primary, secondary, c := newFailover(t, 2, time.Minute)
+	primary.SetQuote("ACME", "1")
+	secondary.SetQuote("ACME", "2")
+	primary.Fail(http.StatusServiceUnavailable)
+	for i := 0; i < 2; i++ {
+		if got := price(t, f, "ACME"); got != "2" {
+			t.Fatalf("expected the secondary backend, got %s", got)
+		}
+	}
+	if state := f.Health()[0].State; state != finance.BreakerOpen {
+		t.Fatalf("expected the circuit to open after 2 failures, got %s", state)
+	}
+	price(t, f, "ACME")
+	if primary.Requests() != 2 {
+		t.Errorf("expected an open circuit to skip the backend, got %d requests", primary.Requests())
+	}
+
+	// a failed trial opens the circuit again
+	c.Advance(time.Minute)
+	price(t, f, "ACME")
+	if primary.Requests() != 3 || f.Health()[0].State != finance.BreakerOpen {
+		t.Errorf("expected a failed trial to reopen the circuit, got %s after %d requests", f.Health()[0].State, primary.Requests())
+	}
+	c.Advance(time.Minute - time.Second)
+	price(t, f, "ACME")
+	if primary.Requests() != 3 {
+		t.Errorf("expected the cooldown to restart with the failed trial")
+	}
+
+	// a successful trial closes the circuit
+	c.Advance(time.Second)
+	primary.Recover()
+	if got := price(t, f, "ACME"); got != "1" {
+		t.Errorf("expected the trial to be answered by the primary backend, got %s", got)
+	}
+	if health := f.Health()[0]; health.State != finance.BreakerClosed || health.ConsecutiveFailures != 0 {
+		t.Errorf("expected a successful trial to close the circuit, got %+v", health)
+	}
+}
+
+func TestBreakerSingleTrial(t *testing.T) {
+	f, primary, secondary, c := newFailover(t, 1, time.Minute)
+	primary.SetQuote("ACME", "1")
+	secondary.SetQuote("ACME", "2")
+	primary.Fail(http.StatusServiceUnavailable)
+	price(t, f, "ACME")
+	c.Advance(time.Minute)
+	if !f.Allow("primary") || f.Health()[0].State != finance.BreakerHalfOpen {
+		t.Fatalf("expected the circuit to turn half-open after the cooldown, got %s", f.Health()[0].State)
+	}
+	// the trial is pending, so no other request passes
+	if f.Allow("primary") {
+		t.Error("expected a half-open circuit to reject requests during the trial")
+	}
+	if got := price(t, f, "ACME"); got != "2" || primary.Requests() != 1 {
+		t.Errorf("expected the secondary backend during the trial, got %s", got)
+	}
+}
+
+// batchSource fetches the quotes of a chunk from the fake backend. The chunk fails, if a
+// symbol of it fails.
+type batchSource struct {
+	finance.QuoteSource
+	mutex  sync.Mutex
+	chunks [][]string
+}
+
+func (b *batchSource) BatchSize() int {
+	return 2
+}
+
+func (b *batchSource) Quotes(ctx context.Context, symbols []string) (map[string]*finance.Quote, error) {
+	b.mutex.Lock()
+	b.chunks = append(b.chunks, symbols)
+	b.mutex.Unlock()
+	quotes := make(map[string]*finance.Quote)
+	for _, symbol := range symbols {
+		quote, err := b.Quote(ctx, symbol)
+		switch {
+		case errors.Is(err, finance.ErrSymbolNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			quotes[strings.ToUpper(symbol)] = quote
+		}
+	}
+	return quotes, nil
+}
+
+func TestFailoverBatch(t *testing.T) {
+	primary, secondary := financetest.NewBackend(t), financetest.NewBackend(t)
+	batch := &batchSource{QuoteSource: primary.Source()}
+	f := finance.NewFailover([]string{"primary", "secondary"}, []finance.QuoteSource{batch, secondary.Source()}, 5, time.Minute, 1)
+	primary.SetQuote("A", "1")
+	primary.SetQuote("B", "1")
+	primary.SetQuote("C", "1")
+	primary.SetFields("D", map[string]string{"05. price": "invalid"})
+	for _, symbol := range []string{"A", "B", "C", "D", "E"} {
+		secondary.SetQuote(symbol, "2")
+	}
+	results, err := f.Quotes(context.Background(), []string{"a", "B", "A", "", "C", "D", "UNKNOWN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "1", "B": "1", "C": "2", "D": "2"}
+	if len(results) != 5 {
+		t.Fatalf("expected the unique symbols, got %d results", len(results))
+	}
+	for _, result := range results[:4] {
+		if result.Err != nil || result.Quote.Price.Amount.String() != want[result.Symbol] {
+			t.Errorf("%s: expected price %s, got %v %v", result.Symbol, want[result.Symbol], result.Quote, result.Err)
+		}
+	}
+	if !errors.Is(results[4].Err, finance.ErrSymbolNotFound) {
+		t.Errorf("expected an unknown symbol, got %v", results[4].Err)
+	}
+	if len(batch.chunks) != 3 {
+		t.Errorf("expected chunks of 2 symbols, got %v", batch.chunks)
+	}
+	// the symbols of the failed chunk C, D and the unknown symbol are passed to the next backend
+	if secondary.Requests() != 3 {
+		t.Errorf("expected the secondary backend to be asked for the failed chunk only, got %d requests", secondary.Requests())
+	}
+}
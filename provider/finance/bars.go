@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// ErrInvalidInterval is returned for intervals, which aren't supported.
+	ErrInvalidInterval = errors.New("invalid interval")
+	// ErrInvalidRange is returned, when the start of a time range is after its end.
+	ErrInvalidRange = errors.New("invalid time range")
+)
+
+// Interval is the period aggregated by a bar.
+type Interval string
+
+const (
+	OneMinute      Interval = "1m"
+	TwoMinutes     Interval = "2m"
+	FiveMinutes    Interval = "5m"
+	FifteenMinutes Interval = "15m"
+	ThirtyMinutes  Interval = "30m"
+	OneHour        Interval = "1h"
+	NinetyMinutes  Interval = "90m"
+	OneDay         Interval = "1d"
+	FiveDays       Interval = "5d"
+	OneWeek        Interval = "1wk"
+	OneMonth       Interval = "1mo"
+)
+
+// Intervals contains all supported intervals from the shortest to the longest.
+var Intervals = []Interval{
+	OneMinute, TwoMinutes, FiveMinutes, FifteenMinutes, ThirtyMinutes, OneHour, NinetyMinutes,
+	OneDay, FiveDays, OneWeek, OneMonth,
+}
+
+// Valid returns true, if the interval is supported.
+func (i Interval) Valid() bool {
+	for _, interval := range Intervals {
+		if i == interval {
+			return true
+		}
+	}
+	return false
+}
+
+// Bar contains the open, high, low, close and volume of an interval. The prices are unadjusted,
+// the adjusted close accounts for dividends and splits.
+type Bar struct {
+	Time          time.Time       `json:"time" xml:"time" csv:"time"`
+	Open          decimal.Decimal `json:"open" xml:"open" csv:"open"`
+	High          decimal.Decimal `json:"high" xml:"high" csv:"high"`
+	Low           decimal.Decimal `json:"low" xml:"low" csv:"low"`
+	Close         decimal.Decimal `json:"close" xml:"close" csv:"close"`
+	AdjustedClose decimal.Decimal `json:"adjustedClose" xml:"adjustedClose" csv:"adjustedClose"`
+	Volume        int64           `json:"volume" xml:"volume" csv:"volume"`
+}
+
+// Adjusted returns the bar with all prices adjusted by the ratio of the adjusted close to the
+// close. Bars without adjusted close are returned unchanged.
+func (b Bar) Adjusted() Bar {
+	if b.Close.IsZero() || b.AdjustedClose.IsZero() {
+		return b
+	}
+	factor := b.AdjustedClose.Div(b.Close)
+	return Bar{
+		Time:          b.Time,
+		Open:          b.Open.Mul(factor),
+		High:          b.High.Mul(factor),
+		Low:           b.Low.Mul(factor),
+		Close:         b.AdjustedClose,
+		AdjustedClose: b.AdjustedClose,
+		Volume:        b.Volume,
+	}
+}
+
+// Dividend is a cash dividend paid per share.
+type Dividend struct {
+	Time   time.Time `json:"time" xml:"time" csv:"time"`
+	Amount Money     `json:"amount" xml:"amount" csv:"amount"`
+}
+
+// Split is a stock split, e.g. 4:1 with numerator 4 and denominator 1.
+type Split struct {
+	Time        time.Time       `json:"time" xml:"time" csv:"time"`
+	Numerator   decimal.Decimal `json:"numerator" xml:"numerator" csv:"numerator"`
+	Denominator decimal.Decimal `json:"denominator" xml:"denominator" csv:"denominator"`
+}
+
+// Ratio returns the number of shares after the split per share before the split.
+func (s Split) Ratio() decimal.Decimal {
+	if s.Denominator.IsZero() {
+		return decimal.Zero
+	}
+	return s.Numerator.Div(s.Denominator)
+}
+
+// Chart contains the bars of an instrument in a time range together with the dividends and
+// splits in that range.
+type Chart struct {
+	Instrument Instrument `json:"instrument" xml:"instrument"`
+	Interval   Interval   `json:"interval" xml:"interval"`
+	Bars       []Bar      `json:"bars" xml:"bars>bar"`
+	Dividends  []Dividend `json:"dividends" xml:"dividends>dividend"`
+	Splits     []Split    `json:"splits" xml:"splits>split"`
+	Source     string     `json:"source,omitempty" xml:"source,omitempty"`
+}
+
+// AdjustedBars returns the bars with prices adjusted for dividends and splits.
+func (c *Chart) AdjustedBars() []Bar {
+	bars := make([]Bar, len(c.Bars))
+	for i, bar := range c.Bars {
+		bars[i] = bar.Adjusted()
+	}
+	return bars
+}
+
+// BarSource is a backend providing historical bars.
+type BarSource interface {
+	Bars(ctx context.Context, symbol string, interval Interval, from, to time.Time) (*Chart, error)
+}
+
+// validateBars checks the parameters before any backend is asked.
+func validateBars(interval Interval, from, to time.Time) error {
+	if !interval.Valid() {
+		return fmt.Errorf("%w: %s", ErrInvalidInterval, interval)
+	}
+	if from.After(to) {
+		return fmt.Errorf("%w: %s is after %s", ErrInvalidRange, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return nil
+}
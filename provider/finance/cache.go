@@ -0,0 +1,331 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boot-go/boot"
+)
+
+var (
+	// ErrUnknownCache is returned, when the configured cache isn't registered.
+	ErrUnknownCache  = errors.New("unknown quote cache")
+	errFlightAborted = errors.New("shared quote request aborted")
+)
+
+// cacheMetrics are published with expvar, e.g. at /debug/vars when the expvar handler is mounted.
+var cacheMetrics = expvar.NewMap("boot_stack_finance_cache")
+
+// CacheEntry is a cached quote. The quote is fresh until it expires, afterwards it is only served
+// when all backends fail.
+type CacheEntry struct {
+	Quote   *Quote
+	Fetched time.Time
+	Expires time.Time
+}
+
+// QuoteCache stores quotes by upper case symbol and must be safe for concurrent use. Expired
+// entries should be kept as long as possible, because they are the fallback of failing backends.
+type QuoteCache interface {
+	Get(symbol string) (CacheEntry, bool)
+	Set(symbol string, entry CacheEntry)
+}
+
+// CacheFactory creates a cache, which holds up to size quotes. It is called once when the finance
+// component is initialized.
+type CacheFactory func(size int) (QuoteCache, error)
+
+// cacheFactories contains the caches registered by other packages.
+var cacheFactories = struct {
+	sync.RWMutex
+	factories map[string]CacheFactory
+}{factories: make(map[string]CacheFactory)}
+
+// RegisterCache registers a cache, which can be selected with FINANCE_CACHE. A registered cache
+// replaces a built-in cache with the same name.
+func RegisterCache(name string, factory CacheFactory) {
+	cacheFactories.Lock()
+	defer cacheFactories.Unlock()
+	cacheFactories.factories[strings.ToLower(name)] = factory
+}
+
+func registeredCache(name string) (CacheFactory, bool) {
+	cacheFactories.RLock()
+	defer cacheFactories.RUnlock()
+	factory, ok := cacheFactories.factories[name]
+	return factory, ok
+}
+
+// MemoryCache is an in-memory cache, which evicts the least recently used quote when it is full.
+type MemoryCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryEntry struct {
+	symbol string
+	entry  CacheEntry
+}
+
+// NewMemoryCache creates an in-memory cache holding up to size quotes, but at least one.
+func NewMemoryCache(size int) *MemoryCache {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryCache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+func (m *MemoryCache) Get(symbol string) (CacheEntry, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	element, ok := m.entries[symbol]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	m.order.MoveToFront(element)
+	return element.Value.(*memoryEntry).entry, true
+}
+
+func (m *MemoryCache) Set(symbol string, entry CacheEntry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if element, ok := m.entries[symbol]; ok {
+		element.Value.(*memoryEntry).entry = entry
+		m.order.MoveToFront(element)
+		return
+	}
+	m.entries[symbol] = m.order.PushFront(&memoryEntry{symbol: symbol, entry: entry})
+	for m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).symbol)
+		cacheMetrics.Add("evictions", 1)
+	}
+}
+
+// Len returns the number of cached quotes.
+func (m *MemoryCache) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.order.Len()
+}
+
+// quoteLookup is implemented by the failover and the cache in front of it.
+type quoteLookup interface {
+	Quote(ctx context.Context, symbol string) (*Quote, error)
+	Quotes(ctx context.Context, symbols []string) ([]QuoteResult, error)
+}
+
+// quoteCache caches the quotes of the backends. Quotes of closed markets are cached longer,
+// concurrent requests of a symbol share a single upstream request and expired quotes up to the
+// max staleness are served when the backends fail.
+type quoteCache struct {
+	source    quoteLookup
+	store     QuoteCache
+	ttl       time.Duration
+	closedTTL time.Duration
+	maxStale  time.Duration
+	flight    flight
+	now       func() time.Time
+}
+
+func newQuoteCache(source quoteLookup, store QuoteCache, ttl, closedTTL, maxStale time.Duration) *quoteCache {
+	return &quoteCache{
+		source:    source,
+		store:     store,
+		ttl:       ttl,
+		closedTTL: closedTTL,
+		maxStale:  maxStale,
+		flight:    flight{calls: make(map[string]*flightCall)},
+		now:       time.Now,
+	}
+}
+
+func (c *quoteCache) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	key := strings.ToUpper(symbol)
+	if quote, ok := c.fresh(key); ok {
+		return quote, nil
+	}
+	for {
+		quote, shared, err := c.flight.do(ctx, key, func() (*Quote, error) {
+			return c.fetch(ctx, symbol, key)
+		})
+		if shared {
+			cacheMetrics.Add("coalesced", 1)
+			// the request of another caller was canceled, which doesn't affect this caller
+			if isContextError(err) && ctx.Err() == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		copied := *quote
+		return &copied, nil
+	}
+}
+
+func (c *quoteCache) Quotes(ctx context.Context, symbols []string) ([]QuoteResult, error) {
+	unique := uniqueSymbols(symbols)
+	results := make([]QuoteResult, len(unique))
+	var missing []string
+	var positions []int
+	for i, symbol := range unique {
+		results[i].Symbol = symbol
+		if quote, ok := c.fresh(strings.ToUpper(symbol)); ok {
+			results[i].Quote = quote
+			continue
+		}
+		missing = append(missing, symbol)
+		positions = append(positions, i)
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+	fetched, err := c.source.Quotes(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range fetched {
+		key := strings.ToUpper(result.Symbol)
+		if result.Err == nil {
+			c.store.Set(key, c.entry(result.Quote))
+		} else if quote, ok := c.stale(ctx, key, result.Err); ok {
+			result.Quote, result.Err = quote, nil
+		}
+		if result.Quote != nil {
+			copied := *result.Quote
+			result.Quote = &copied
+		}
+		results[positions[i]] = result
+	}
+	return results, nil
+}
+
+// fresh returns a copy of the cached quote, if it hasn't expired.
+func (c *quoteCache) fresh(key string) (*Quote, bool) {
+	entry, ok := c.store.Get(key)
+	if !ok || !c.now().Before(entry.Expires) {
+		cacheMetrics.Add("misses", 1)
+		return nil, false
+	}
+	cacheMetrics.Add("hits", 1)
+	copied := *entry.Quote
+	return &copied, true
+}
+
+// fetch requests the quote from the backends and caches it. The expired quote is returned, when
+// the backends fail.
+func (c *quoteCache) fetch(ctx context.Context, symbol, key string) (*Quote, error) {
+	quote, err := c.source.Quote(ctx, symbol)
+	if err != nil {
+		if stale, ok := c.stale(ctx, key, err); ok {
+			return stale, nil
+		}
+		return nil, err
+	}
+	c.store.Set(key, c.entry(quote))
+	return quote, nil
+}
+
+// entry returns the cache entry of the quote. The ttl of closed markets is used, when the market
+// of the quote is closed.
+func (c *quoteCache) entry(quote *Quote) CacheEntry {
+	now := c.now()
+	ttl := c.ttl
+	if quote.MarketState == MarketClosed {
+		ttl = c.closedTTL
+	}
+	return CacheEntry{Quote: quote, Fetched: now, Expires: now.Add(ttl)}
+}
+
+// stale returns the cached quote after a failure of the backends, if it isn't older than the max
+// staleness. Unknown symbols and canceled requests aren't answered from the cache.
+func (c *quoteCache) stale(ctx context.Context, key string, err error) (*Quote, bool) {
+	if errors.Is(err, ErrSymbolNotFound) || isContextError(err) {
+		return nil, false
+	}
+	entry, ok := c.store.Get(key)
+	if !ok || c.now().Sub(entry.Fetched) > c.maxStale {
+		return nil, false
+	}
+	cacheMetrics.Add("stale", 1)
+	boot.Logger.Warn.Printf("serving quote of %s fetched at %s: %v%s", key, entry.Fetched.Format(time.RFC3339), err, requestSuffix(ctx))
+	return entry.Quote, true
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// flight coalesces concurrent requests of the same symbol into a single upstream request.
+type flight struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	quote *Quote
+	err   error
+}
+
+// do calls fn, unless a call for the key is in flight, whose result is shared instead. Waiting for
+// a shared result stops, when the context is done.
+func (f *flight) do(ctx context.Context, key string, fn func() (*Quote, error)) (*Quote, bool, error) {
+	f.mutex.Lock()
+	if call, ok := f.calls[key]; ok {
+		f.mutex.Unlock()
+		select {
+		case <-call.done:
+			return call.quote, true, call.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	call := &flightCall{done: make(chan struct{}), err: errFlightAborted}
+	f.calls[key] = call
+	f.mutex.Unlock()
+	defer func() {
+		f.mutex.Lock()
+		delete(f.calls, key)
+		f.mutex.Unlock()
+		close(call.done)
+	}()
+	call.quote, call.err = fn()
+	return call.quote, false, call.err
+}
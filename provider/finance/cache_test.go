@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boot-go/stack/provider/finance"
+	"github.com/boot-go/stack/provider/finance/financetest"
+)
+
+// closedSource reports the quotes of the closed symbols with a closed market.
+type closedSource struct {
+	finance.QuoteSource
+	closed map[string]bool
+}
+
+func (s closedSource) Quote(ctx context.Context, symbol string) (*finance.Quote, error) {
+	quote, err := s.QuoteSource.Quote(ctx, symbol)
+	if err == nil && s.closed[symbol] {
+		quote.MarketState = finance.MarketClosed
+	}
+	return quote, err
+}
+
+// newQuoteCache creates a cache with a ttl of one minute, a closed ttl of one hour and a max
+// staleness of one day in front of the fake backend.
+func newQuoteCache(t *testing.T, size int) (*finance.QuoteCacheLookup, *financetest.Backend, *clock) {
+	t.Helper()
+	fake := financetest.NewBackend(t)
+	source := closedSource{QuoteSource: fake.Source(), closed: map[string]bool{"CLOSED": true}}
+	f := finance.NewFailover([]string{"fake"}, []finance.QuoteSource{source}, 100, time.Minute, 1)
+	cache := finance.NewQuoteCache(f, finance.NewMemoryCache(size), time.Minute, time.Hour, 24*time.Hour)
+	c := &clock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	f.SetClock(c.Now)
+	cache.SetClock(c.Now)
+	return cache, fake, c
+}
+
+func cachedPrice(t *testing.T, cache *finance.QuoteCacheLookup, symbol string) string {
+	t.Helper()
+	quote, err := cache.Quote(context.Background(), symbol)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return quote.Price.Amount.String()
+}
+
+func TestQuoteCacheTTL(t *testing.T) {
+	cache, fake, c := newQuoteCache(t, 10)
+	fake.SetQuote("OPEN", "1")
+	fake.SetQuote("CLOSED", "1")
+	cachedPrice(t, cache, "OPEN")
+	cachedPrice(t, cache, "CLOSED")
+	fake.SetQuote("OPEN", "2")
+	fake.SetQuote("CLOSED", "2")
+	c.Advance(time.Minute - time.Second)
+	if cachedPrice(t, cache, "open") != "1" || fake.Requests() != 2 {
+		t.Errorf("expected the fresh quote from the cache regardless of the case of the symbol")
+	}
+	c.Advance(time.Second)
+	if cachedPrice(t, cache, "OPEN") != "2" {
+		t.Error("expected the expired quote to be fetched again")
+	}
+	if cachedPrice(t, cache, "CLOSED") != "1" {
+		t.Error("expected the quote of a closed market to be cached with the closed ttl")
+	}
+	c.Advance(time.Hour)
+	if cachedPrice(t, cache, "CLOSED") != "2" {
+		t.Error("expected the quote of a closed market to expire after the closed ttl")
+	}
+}
+
+func TestQuoteCacheCopies(t *testing.T) {
+	cache, fake, _ := newQuoteCache(t, 10)
+	fake.SetQuote("ACME", "1")
+	quote, err := cache.Quote(context.Background(), "ACME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote.Symbol = "CHANGED"
+	if cached, _ := cache.Quote(context.Background(), "ACME"); cached.Symbol != "ACME" {
+		t.Errorf("expected a copy of the cached quote, got %s", cached.Symbol)
+	}
+}
+
+func TestQuoteCacheCoalescing(t *testing.T) {
+	cache, fake, _ := newQuoteCache(t, 10)
+	fake.SetQuote("ACME", "1")
+	fake.Delay(100 * time.Millisecond)
+	var wg sync.WaitGroup
+	quotes := make([]*finance.Quote, 10)
+	for i := range quotes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			quote, err := cache.Quote(context.Background(), "ACME")
+			if err != nil {
+				t.Error(err)
+			}
+			quotes[i] = quote
+		}(i)
+	}
+	wg.Wait()
+	if fake.Requests() != 1 {
+		t.Errorf("expected concurrent requests to share one upstream request, got %d", fake.Requests())
+	}
+	for _, quote := range quotes[1:] {
+		if quote == quotes[0] {
+			t.Fatal("expected each caller to get its own copy of the shared quote")
+		}
+	}
+}
+
+func TestQuoteCacheCanceledFlight(t *testing.T) {
+	cache, fake, _ := newQuoteCache(t, 10)
+	fake.SetQuote("ACME", "1")
+	fake.Delay(100 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := cache.Quote(ctx, "ACME")
+		canceled <- err
+	}()
+	for fake.Requests() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	shared := make(chan string, 1)
+	go func() {
+		shared <- cachedPrice(t, cache, "ACME")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled caller to fail, got %v", err)
+	}
+	if got := <-shared; got != "1" {
+		t.Errorf("expected the waiting caller to fetch the quote again, got %s", got)
+	}
+}
+
+func TestQuoteCacheStale(t *testing.T) {
+	cache, fake, c := newQuoteCache(t, 10)
+	fake.SetQuote("ACME", "1")
+	fake.SetQuote("EMCA", "1")
+	cachedPrice(t, cache, "ACME")
+	cachedPrice(t, cache, "EMCA")
+	fake.Fail(http.StatusServiceUnavailable)
+	c.Advance(time.Hour)
+	if cachedPrice(t, cache, "ACME") != "1" {
+		t.Error("expected the expired quote, when the backend fails")
+	}
+	results, err := cache.Quotes(context.Background(), []string{"ACME", "EMCA", "UNKNOWN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[1].Err != nil || !errors.Is(results[2].Err, finance.ErrNoBackendAvailable) {
+		t.Errorf("expected the expired quotes of the batch, got %+v", results)
+	}
+	c.Advance(24 * time.Hour)
+	if _, err := cache.Quote(context.Background(), "ACME"); !errors.Is(err, finance.ErrNoBackendAvailable) {
+		t.Errorf("expected quotes beyond the max staleness to be dropped, got %v", err)
+	}
+}
+
+func TestQuoteCacheEviction(t *testing.T) {
+	cache, fake, _ := newQuoteCache(t, 2)
+	for _, symbol := range []string{"A", "B", "C"} {
+		fake.SetQuote(symbol, "1")
+	}
+	cachedPrice(t, cache, "A")
+	cachedPrice(t, cache, "B")
+	cachedPrice(t, cache, "A")
+	cachedPrice(t, cache, "C")
+	requests := fake.Requests()
+	cachedPrice(t, cache, "A")
+	cachedPrice(t, cache, "C")
+	if fake.Requests() != requests {
+		t.Errorf("expected the recently used quotes to stay cached")
+	}
+	cachedPrice(t, cache, "B")
+	if fake.Requests() != requests+1 {
+		t.Errorf("expected the least recently used quote to be evicted")
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache := finance.NewMemoryCache(0)
+	cache.Set("A", finance.CacheEntry{Quote: &finance.Quote{}})
+	cache.Set("B", finance.CacheEntry{Quote: &finance.Quote{}})
+	if _, ok := cache.Get("A"); ok || cache.Len() != 1 {
+		t.Errorf("expected a cache of at least one quote, got %d", cache.Len())
+	}
+	cache = finance.NewMemoryCache(2)
+	cache.Set("A", finance.CacheEntry{})
+	cache.Set("B", finance.CacheEntry{})
+	cache.Set("A", finance.CacheEntry{Fetched: time.Unix(1, 0)})
+	cache.Set("C", finance.CacheEntry{})
+	if _, ok := cache.Get("B"); ok {
+		t.Error("expected B to be evicted")
+	}
+	if entry, ok := cache.Get("A"); !ok || !entry.Fetched.Equal(time.Unix(1, 0)) {
+		t.Error("expected the updated entry of A")
+	}
+}
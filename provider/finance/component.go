@@ -24,24 +24,187 @@
 package finance
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/boot-go/boot"
-	"github.com/piquette/finance-go"
-	"github.com/piquette/finance-go/quote"
 )
 
+// component provides market data of the backends configured with FINANCE_PROVIDERS. The backends
+// are asked in the configured order, a backend is skipped while its circuit is open.
 type component struct {
+	Providers       string `boot:"config,key:${FINANCE_PROVIDERS},default:yahoo"`                                // comma separated backends in the order of priority
+	BreakerFailures int    `boot:"config,key:${FINANCE_BREAKER_FAILURES},default:5"`                             // consecutive failures opening the circuit
+	BreakerCooldown int    `boot:"config,key:${FINANCE_BREAKER_COOLDOWN},default:30"`                            // seconds until an open circuit is tried again
+	AlphaVantageKey string `boot:"config,key:${FINANCE_ALPHAVANTAGE_KEY},default:"`                              // api key of alphavantage
+	AlphaVantageURL string `boot:"config,key:${FINANCE_ALPHAVANTAGE_URL},default:'https://www.alphavantage.co'"` // base url of alphavantage
+	FilePath        string `boot:"config,key:${FINANCE_FILE_PATH},default:"`                                     // json file of the file backend
+	Concurrency     int    `boot:"config,key:${FINANCE_BATCH_CONCURRENCY},default:4"`                            // parallel upstream requests of a batch
+	Cache           string `boot:"config,key:${FINANCE_CACHE},default:memory"`                                   // quote cache, none disables caching
+	CacheSize       int    `boot:"config,key:${FINANCE_CACHE_SIZE},default:10000"`                               // max number of cached quotes
+	CacheTTL        int    `boot:"config,key:${FINANCE_CACHE_TTL},default:15"`                                   // seconds a quote is fresh
+	CacheClosedTTL  int    `boot:"config,key:${FINANCE_CACHE_CLOSED_TTL},default:600"`                           // seconds a quote is fresh, when the market is closed
+	CacheMaxStale   int    `boot:"config,key:${FINANCE_CACHE_MAX_STALE},default:3600"`                           // seconds an expired quote is served, when all backends fail
+	RateLimits      string `boot:"config,key:${FINANCE_RATE_LIMITS},default:"`                                   // comma separated backend:perSecond:perDay limits
+	RetryAttempts   int    `boot:"config,key:${FINANCE_RETRY_ATTEMPTS},default:3"`                               // attempts per backend for rate limits and unavailable upstreams
+	RetryBackoff    int    `boot:"config,key:${FINANCE_RETRY_BACKOFF},default:200"`                              // milliseconds before the first retry, doubled for each retry
+	RetryMaxBackoff int    `boot:"config,key:${FINANCE_RETRY_MAX_BACKOFF},default:5000"`                         // max milliseconds between retries
+	source          *failover
+	quotes          quoteLookup
 }
 
 func (c *component) Init() error {
+	var names []string
+	var sources []QuoteSource
+	for _, name := range strings.Split(c.Providers, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		source, err := c.createBackend(name)
+		if err != nil {
+			return err
+		}
+		boot.Logger.Debug.Printf("market data backend %s has priority %d", name, len(sources))
+		names = append(names, name)
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("%w: FINANCE_PROVIDERS is empty", ErrNoBackendAvailable)
+	}
+	c.source = newFailover(names, sources, c.BreakerFailures, seconds(c.BreakerCooldown), c.Concurrency)
+	if c.RetryAttempts > 1 {
+		c.source.retry = retryPolicy{
+			attempts:   c.RetryAttempts,
+			backoff:    time.Duration(c.RetryBackoff) * time.Millisecond,
+			maxBackoff: time.Duration(c.RetryMaxBackoff) * time.Millisecond,
+		}
+	}
+	limits, err := parseRateLimits(c.RateLimits)
+	if err != nil {
+		return err
+	}
+	for name, limit := range limits {
+		if !c.source.limit(name, limit) {
+			boot.Logger.Warn.Printf("rate limit of market data backend %s ignored, the backend isn't configured", name)
+		}
+	}
+	c.quotes = c.source
+	store, err := c.createCache(strings.ToLower(strings.TrimSpace(c.Cache)))
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		c.quotes = newQuoteCache(c.source, store, seconds(c.CacheTTL), seconds(c.CacheClosedTTL), seconds(c.CacheMaxStale))
+	}
 	return nil
 }
 
-func (c *component) Quote(symbol string) (*finance.Quote, error) {
-	quoteResult, err := quote.Get(symbol)
+// createCache creates a registered or built-in cache. No cache is returned, when caching is
+// disabled.
+func (c *component) createCache(name string) (QuoteCache, error) {
+	if factory, ok := registeredCache(name); ok {
+		return factory(c.CacheSize)
+	}
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "memory":
+		return NewMemoryCache(c.CacheSize), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCache, name)
+	}
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// createBackend creates a registered or built-in backend.
+func (c *component) createBackend(name string) (QuoteSource, error) {
+	if factory, ok := registeredBackend(name); ok {
+		return factory()
+	}
+	switch name {
+	case "yahoo":
+		return NewYahooSource(), nil
+	case "alphavantage":
+		return NewAlphaVantageSource(c.AlphaVantageKey, c.AlphaVantageURL, nil)
+	case "file":
+		return NewFileSource(c.FilePath)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, name)
+	}
+}
+
+func (c *component) Quote(symbol string) (*Quote, error) {
+	return c.QuoteContext(context.Background(), symbol)
+}
+
+func (c *component) QuoteContext(ctx context.Context, symbol string) (*Quote, error) {
+	return c.quotes.Quote(ctx, symbol)
+}
+
+func (c *component) Quotes(ctx context.Context, symbols []string) ([]QuoteResult, error) {
+	return c.quotes.Quotes(ctx, symbols)
+}
+
+func (c *component) Bars(ctx context.Context, symbol string, interval Interval, from, to time.Time) (*Chart, error) {
+	return c.source.Bars(ctx, symbol, interval, from, to)
+}
+
+func (c *component) Instrument(ctx context.Context, symbol string) (*Instrument, error) {
+	asset, err := c.source.Asset(ctx, symbol)
 	if err != nil {
 		return nil, err
 	}
-	return quoteResult, nil
+	return &asset.Common().Instrument, nil
+}
+
+func (c *component) Equity(ctx context.Context, symbol string) (*EquityQuote, error) {
+	return lookupAsset[*EquityQuote](ctx, c.source, symbol, Equity)
+}
+
+func (c *component) ETF(ctx context.Context, symbol string) (*FundQuote, error) {
+	return lookupAsset[*FundQuote](ctx, c.source, symbol, ETF)
+}
+
+func (c *component) MutualFund(ctx context.Context, symbol string) (*FundQuote, error) {
+	return lookupAsset[*FundQuote](ctx, c.source, symbol, MutualFund)
+}
+
+func (c *component) Index(ctx context.Context, symbol string) (*Quote, error) {
+	return lookupAsset[*Quote](ctx, c.source, symbol, Index)
+}
+
+func (c *component) CurrencyPair(ctx context.Context, symbol string) (*CurrencyPairQuote, error) {
+	return lookupAsset[*CurrencyPairQuote](ctx, c.source, symbol, Currency)
+}
+
+func (c *component) Crypto(ctx context.Context, symbol string) (*CryptoQuote, error) {
+	return lookupAsset[*CryptoQuote](ctx, c.source, symbol, Crypto)
+}
+
+func (c *component) Future(ctx context.Context, symbol string) (*FutureQuote, error) {
+	return lookupAsset[*FutureQuote](ctx, c.source, symbol, Future)
+}
+
+func (c *component) Option(ctx context.Context, symbol string) (*OptionQuote, error) {
+	return lookupAsset[*OptionQuote](ctx, c.source, symbol, Option)
+}
+
+func (c *component) Expirations(ctx context.Context, underlying string) ([]time.Time, error) {
+	return c.source.Expirations(ctx, underlying)
+}
+
+func (c *component) OptionChain(ctx context.Context, underlying string, expiry time.Time) (*OptionChain, error) {
+	return c.source.OptionChain(ctx, underlying, expiry)
+}
+
+func (c *component) Backends() []BackendHealth {
+	return c.source.health()
 }
 
 func init() {
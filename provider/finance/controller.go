@@ -23,8 +23,46 @@
 
 package finance
 
-import "github.com/piquette/finance-go"
+import (
+	"context"
+	"time"
+)
 
+// Controller provides market data in the provider-agnostic model. Methods with context stop the
+// upstream lookup when the context is canceled or its deadline exceeds, and forward the request
+// id to the backends. The methods without context are kept for compatibility.
+//
+// Errors can be matched with errors.Is: ErrSymbolNotFound for unknown symbols, ErrRateLimited
+// and ErrUpstreamUnavailable for failed backends and ErrNotSupported for operations without
+// backend. RetryAfter returns the backoff of rate limited backends.
 type Controller interface {
-	Quote(symbol string) (*finance.Quote, error)
+	// Quote is QuoteContext with the background context.
+	Quote(symbol string) (*Quote, error)
+	// QuoteContext stops the upstream lookup when the context is canceled or its deadline exceeds.
+	QuoteContext(ctx context.Context, symbol string) (*Quote, error)
+	// Quotes fetches many symbols with as few upstream requests as possible. Every symbol has its
+	// own result, the error is only set when the context is done.
+	Quotes(ctx context.Context, symbols []string) ([]QuoteResult, error)
+	// Bars returns the bars of the interval between from and to, including the dividends and
+	// splits in that time range. Intervals range from OneMinute to OneMonth.
+	Bars(ctx context.Context, symbol string, interval Interval, from, to time.Time) (*Chart, error)
+	// Instrument resolves the symbol to its instrument including the asset class.
+	Instrument(ctx context.Context, symbol string) (*Instrument, error)
+	// Typed lookups return ErrAssetClassMismatch, when the symbol belongs to another asset class.
+	Equity(ctx context.Context, symbol string) (*EquityQuote, error)
+	ETF(ctx context.Context, symbol string) (*FundQuote, error)
+	MutualFund(ctx context.Context, symbol string) (*FundQuote, error)
+	Index(ctx context.Context, symbol string) (*Quote, error)
+	CurrencyPair(ctx context.Context, symbol string) (*CurrencyPairQuote, error)
+	Crypto(ctx context.Context, symbol string) (*CryptoQuote, error)
+	Future(ctx context.Context, symbol string) (*FutureQuote, error)
+	Option(ctx context.Context, symbol string) (*OptionQuote, error)
+	// Expirations returns the expirations of the options of the underlying in ascending order.
+	Expirations(ctx context.Context, underlying string) ([]time.Time, error)
+	// OptionChain returns the calls and puts of the underlying for the expiry, a zero expiry
+	// selects the nearest expiration. Use OptionChain.Filter to restrict strikes and moneyness.
+	OptionChain(ctx context.Context, underlying string, expiry time.Time) (*OptionChain, error)
+	// Backends reports the health of the configured backends in the order of their priority. It
+	// doesn't contact the backends, so it takes no context.
+	Backends() []BackendHealth
 }
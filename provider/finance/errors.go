@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrRateLimited is returned, when a backend rejects requests because of its rate limit or
+	// the client-side rate limit of the backend is exhausted.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUpstreamUnavailable is returned, when the upstream api of a backend is unreachable or
+	// fails.
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+)
+
+// BackendError is a failure of a backend. The kind is ErrRateLimited or ErrUpstreamUnavailable,
+// both are matched with errors.Is.
+type BackendError struct {
+	Kind       error
+	StatusCode int           // status of the upstream response, 0 without response
+	RetryAfter time.Duration // time until the backend accepts requests again, 0 if unknown
+	Err        error
+}
+
+func (e *BackendError) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *BackendError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// RetryAfter returns the time until the backend accepts requests again, if the error reports it.
+func RetryAfter(err error) (time.Duration, bool) {
+	var backendErr *BackendError
+	if errors.As(err, &backendErr) && backendErr.RetryAfter > 0 {
+		return backendErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// statusError returns the error of an unexpected response status. Throttling and server errors
+// are classified, other statuses are plain errors.
+func statusError(response *http.Response) error {
+	err := fmt.Errorf("unexpected status %s", response.Status)
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests:
+		return &BackendError{
+			Kind:       ErrRateLimited,
+			StatusCode: response.StatusCode,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After"), time.Now()),
+			Err:        err,
+		}
+	case response.StatusCode >= http.StatusInternalServerError, response.StatusCode == http.StatusRequestTimeout:
+		return &BackendError{Kind: ErrUpstreamUnavailable, StatusCode: response.StatusCode, Err: err}
+	default:
+		return err
+	}
+}
+
+// parseRetryAfter parses the Retry-After header, which is either in seconds or a http date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// classify returns network failures as ErrUpstreamUnavailable, other errors are returned unchanged.
+func classify(err error) error {
+	var backendErr *BackendError
+	var netErr net.Error
+	if err == nil || errors.As(err, &backendErr) || !errors.As(err, &netErr) {
+		return err
+	}
+	return &BackendError{Kind: ErrUpstreamUnavailable, Err: err}
+}
+
+// retryable returns true for rate limits and unavailable upstreams, which may succeed later.
+func retryable(err error) bool {
+	return (errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUpstreamUnavailable)) && !errors.Is(err, errDailyLimit)
+}
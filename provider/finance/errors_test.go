@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		kind       error
+		wait       time.Duration
+	}{
+		{status: http.StatusTooManyRequests, retryAfter: "30", kind: ErrRateLimited, wait: 30 * time.Second},
+		{status: http.StatusTooManyRequests, kind: ErrRateLimited},
+		{status: http.StatusServiceUnavailable, retryAfter: "30", kind: ErrUpstreamUnavailable},
+		{status: http.StatusInternalServerError, kind: ErrUpstreamUnavailable},
+		{status: http.StatusRequestTimeout, kind: ErrUpstreamUnavailable},
+		{status: http.StatusNotFound},
+		{status: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.status), func(t *testing.T) {
+			response := &http.Response{StatusCode: test.status, Status: http.StatusText(test.status), Header: http.Header{}}
+			if test.retryAfter != "" {
+				response.Header.Set("Retry-After", test.retryAfter)
+			}
+			err := statusError(response)
+			if test.kind == nil {
+				if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUpstreamUnavailable) || retryable(err) {
+					t.Errorf("expected a plain error, got %v", err)
+				}
+				return
+			}
+			var backendErr *BackendError
+			if !errors.As(err, &backendErr) || !errors.Is(err, test.kind) || backendErr.StatusCode != test.status || !retryable(err) {
+				t.Fatalf("expected a retryable %v, got %v", test.kind, err)
+			}
+			if wait, _ := RetryAfter(err); wait != test.wait {
+				t.Errorf("expected a Retry-After of %s, got %s", test.wait, wait)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"0", 0},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value, now); got != test.want {
+			t.Errorf("%q: expected %s, got %s", test.value, test.want, got)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	if err := classify(fmt.Errorf("request: %w", netErr)); !errors.Is(err, ErrUpstreamUnavailable) || !errors.Is(err, netErr) {
+		t.Errorf("expected network errors to be unavailable upstreams, got %v", err)
+	}
+	rateLimited := &BackendError{Kind: ErrRateLimited, Err: netErr}
+	if err := classify(rateLimited); err != rateLimited {
+		t.Errorf("expected backend errors to be unchanged, got %v", err)
+	}
+	plain := errors.New("invalid response")
+	if err := classify(plain); err != plain || retryable(err) {
+		t.Errorf("expected other errors to be unchanged, got %v", err)
+	}
+	if classify(nil) != nil {
+		t.Error("expected nil to stay nil")
+	}
+}
+
+func TestBackendError(t *testing.T) {
+	err := &BackendError{Kind: ErrRateLimited}
+	if err.Error() != "rate limited" || !errors.Is(err, ErrRateLimited) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, ok := RetryAfter(err); ok {
+		t.Error("expected no Retry-After")
+	}
+	cause := errors.New("cause")
+	err = &BackendError{Kind: ErrUpstreamUnavailable, Err: cause}
+	if err.Error() != "upstream unavailable: cause" || !errors.Is(err, cause) || !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import "time"
+
+// Failover exposes the failover to the external tests, which use the fake backend of financetest.
+type Failover = failover
+
+// NewFailover creates the failover of the backends with a single attempt per backend.
+func NewFailover(names []string, sources []QuoteSource, threshold int, cooldown time.Duration, concurrency int) *Failover {
+	return newFailover(names, sources, threshold, cooldown, concurrency)
+}
+
+// SetClock replaces the clock of the circuit breakers.
+func (f *failover) SetClock(now func() time.Time) {
+	f.now = now
+}
+
+// Allow returns true, if the circuit of the backend lets a request pass.
+func (f *failover) Allow(name string) bool {
+	for _, b := range f.backends {
+		if b.name == name {
+			return b.allow(f.now())
+		}
+	}
+	return false
+}
+
+// Health returns the health of the backends in the order of their priority.
+func (f *failover) Health() []BackendHealth {
+	return f.health()
+}
+
+// QuoteCacheLookup exposes the quote cache in front of the failover to the external tests.
+type QuoteCacheLookup = quoteCache
+
+// NewQuoteCache creates the quote cache in front of the failover.
+func NewQuoteCache(f *Failover, store QuoteCache, ttl, closedTTL, maxStale time.Duration) *QuoteCacheLookup {
+	return newQuoteCache(f, store, ttl, closedTTL, maxStale)
+}
+
+// SetClock replaces the clock of the expiration.
+func (c *quoteCache) SetClock(now func() time.Time) {
+	c.now = now
+}
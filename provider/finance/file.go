@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// ErrMissingFilePath is returned, when the file backend is selected without path.
+var ErrMissingFilePath = errors.New("missing file path")
+
+// fileSource provides quotes of a JSON file containing an array of quotes. The file is read on
+// every lookup, so it can be changed while the application is running.
+type fileSource struct {
+	path string
+}
+
+// NewFileSource creates the quote source backed by a JSON file.
+func NewFileSource(path string) (QuoteSource, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file: %w", ErrMissingFilePath)
+	}
+	return &fileSource{path: path}, nil
+}
+
+func (f *fileSource) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	quotes, err := f.Quotes(ctx, []string{symbol})
+	if err != nil {
+		return nil, err
+	}
+	quote, ok := quotes[strings.ToUpper(symbol)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	}
+	return quote, nil
+}
+
+// BatchSize is unlimited, because the file is read at once.
+func (f *fileSource) BatchSize() int {
+	return math.MaxInt
+}
+
+func (f *fileSource) Quotes(ctx context.Context, symbols []string) (map[string]*Quote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("file: %w", err)
+	}
+	var quotes []Quote
+	if err := json.Unmarshal(data, &quotes); err != nil {
+		return nil, fmt.Errorf("file: %s: %w", f.path, err)
+	}
+	requested := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		requested[strings.ToUpper(symbol)] = true
+	}
+	result := make(map[string]*Quote, len(symbols))
+	for i := range quotes {
+		symbol := strings.ToUpper(quotes[i].Symbol)
+		if !requested[symbol] {
+			continue
+		}
+		quote := quotes[i]
+		if quote.Source == "" {
+			quote.Source = "file"
+		}
+		result[symbol] = &quote
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+// Package financeapi mounts REST endpoints for the market data of provider/finance on the chi
+// server. The component is registered on import and serves the routes when FINANCE_API_ENABLED
+// is set:
+//
+//	GET /finance/quotes/{symbol}
+//	GET /finance/quotes?symbols=AAPL,MSFT
+//	GET /finance/bars/{symbol}?interval=1d&from=2024-01-01&to=2024-02-01&adjusted=true
+//	GET /finance/options/{symbol}?expiry=2024-01-19&moneyness=otm&minStrike=150&maxStrike=200
+//	GET /finance/options/{symbol}/expirations
+package financeapi
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boot-go/boot"
+	"github.com/boot-go/stack/provider/finance"
+	server "github.com/boot-go/stack/server/chi"
+	"github.com/go-chi/chi/v5"
+)
+
+// component registers the finance routes when the router of the server is initialized.
+type component struct {
+	Eventbus   boot.EventBus      `boot:"wire"`
+	Finance    finance.Controller `boot:"wire"`
+	Enabled    bool               `boot:"config,key:${FINANCE_API_ENABLED},default:false"`   // mount the finance routes
+	Path       string             `boot:"config,key:${FINANCE_API_PATH},default:/finance"`   // mount path of the finance routes
+	MaxAge     int                `boot:"config,key:${FINANCE_API_MAX_AGE},default:15"`      // seconds clients may cache responses
+	MaxSymbols int                `boot:"config,key:${FINANCE_API_MAX_SYMBOLS},default:100"` // max symbols of a batch request
+	Timeout    int                `boot:"config,key:${FINANCE_API_TIMEOUT},default:10"`      // seconds until a request is answered with 504, 0 disables
+}
+
+func (c *component) Init() error {
+	if !c.Enabled {
+		boot.Logger.Debug.Printf("finance api disabled")
+		return nil
+	}
+	c.Path = "/" + strings.Trim(c.Path, "/")
+	return c.Eventbus.Subscribe(func(e server.RouterInitializedEvent) {
+		boot.Logger.Info.Printf("mounting finance api at %s", c.Path)
+		e.Router.Route(c.Path, c.routes)
+	})
+}
+
+// routes registers the endpoints. Successful responses are cacheable for the max age and carry
+// an entity tag, so clients can revalidate them.
+func (c *component) routes(r chi.Router) {
+	h := &handlers{finance: c.Finance, maxSymbols: c.MaxSymbols}
+	if c.Timeout > 0 {
+		r.Use(server.Timeout(time.Duration(c.Timeout)*time.Second, http.StatusGatewayTimeout))
+	}
+	r.Use(
+		server.CacheControl(server.CachePolicy{MaxAge: time.Duration(c.MaxAge) * time.Second, Public: true}),
+		server.ETag(true),
+	)
+	r.Get("/quotes", h.quotes)
+	r.Get("/quotes/{symbol}", h.quote)
+	r.Get("/bars/{symbol}", h.bars)
+	r.Get("/options/{symbol}", h.optionChain)
+	r.Get("/options/{symbol}/expirations", h.expirations)
+}
+
+func init() {
+	boot.Register(func() boot.Component {
+		return &component{}
+	})
+}
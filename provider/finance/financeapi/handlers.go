@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package financeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boot-go/boot"
+	"github.com/boot-go/stack/provider/finance"
+	server "github.com/boot-go/stack/server/chi"
+	"github.com/go-chi/chi/v5"
+	"github.com/shopspring/decimal"
+)
+
+// defaultBarsRange is the time range of bars without from parameter.
+const defaultBarsRange = 30 * 24 * time.Hour
+
+// symbolPattern accepts the symbols of all asset classes, e.g. BRK.B, ^GSPC, EURUSD=X or BTC-USD.
+var symbolPattern = regexp.MustCompile(`^[A-Za-z0-9.^=_-]{1,32}$`)
+
+// errInvalidParameter is answered with 400 Bad Request.
+var errInvalidParameter = errors.New("invalid parameter")
+
+type handlers struct {
+	finance    finance.Controller
+	maxSymbols int
+}
+
+// quoteResult is a result of a batch request. Either the quote or the problem is set.
+type quoteResult struct {
+	Symbol  string          `json:"symbol" xml:"symbol"`
+	Quote   *finance.Quote  `json:"quote,omitempty" xml:"quote,omitempty"`
+	Problem *server.Problem `json:"problem,omitempty" xml:"problem,omitempty"`
+}
+
+func (h *handlers) quote(w http.ResponseWriter, r *http.Request) {
+	symbol, err := symbolParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	quote, err := h.finance.QuoteContext(r.Context(), symbol)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !server.CheckLastModified(w, r, quote.Time) {
+		return
+	}
+	server.Render(w, r, http.StatusOK, quote)
+}
+
+// quotes answers with a result per symbol. Failed symbols have a problem instead of a quote,
+// the status is 200 as long as the request is valid. Partial results aren't cached, complete
+// results are last modified at the time of the latest quote.
+func (h *handlers) quotes(w http.ResponseWriter, r *http.Request) {
+	var symbols []string
+	for _, symbol := range strings.Split(r.URL.Query().Get("symbols"), ",") {
+		if symbol = strings.TrimSpace(symbol); symbol == "" {
+			continue
+		}
+		if !symbolPattern.MatchString(symbol) {
+			writeError(w, r, fmt.Errorf("%w: symbol %q", errInvalidParameter, symbol))
+			return
+		}
+		symbols = append(symbols, symbol)
+	}
+	switch {
+	case len(symbols) == 0:
+		writeError(w, r, fmt.Errorf("%w: symbols is required", errInvalidParameter))
+		return
+	case h.maxSymbols > 0 && len(symbols) > h.maxSymbols:
+		writeError(w, r, fmt.Errorf("%w: more than %d symbols", errInvalidParameter, h.maxSymbols))
+		return
+	}
+	results, err := h.finance.Quotes(r.Context(), symbols)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response := make([]quoteResult, 0, len(results))
+	var lastModified time.Time
+	failed := false
+	for _, result := range results {
+		item := quoteResult{Symbol: result.Symbol, Quote: result.Quote}
+		if result.Err != nil {
+			problem := problemOf(result.Err)
+			item.Problem = &problem
+			failed = true
+		} else if result.Quote != nil && result.Quote.Time.After(lastModified) {
+			lastModified = result.Quote.Time
+		}
+		response = append(response, item)
+	}
+	if failed {
+		w.Header().Set("Cache-Control", "no-store")
+	} else if !server.CheckLastModified(w, r, lastModified) {
+		return
+	}
+	server.Render(w, r, http.StatusOK, response)
+}
+
+// bars answers with the bars of the interval, which defaults to 1d. The time range defaults to
+// the last 30 days, the adjusted parameter replaces the bars with their adjusted prices.
+func (h *handlers) bars(w http.ResponseWriter, r *http.Request) {
+	symbol, err := symbolParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	query := r.URL.Query()
+	interval := finance.Interval(query.Get("interval"))
+	if interval == "" {
+		interval = finance.OneDay
+	}
+	to, err := timeParam(r, "to", time.Now())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	from, err := timeParam(r, "from", to.Add(-defaultBarsRange))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	adjusted, err := boolParam(r, "adjusted")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	chart, err := h.finance.Bars(r.Context(), symbol, interval, from, to)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if adjusted {
+		chart.Bars = chart.AdjustedBars()
+	}
+	server.Render(w, r, http.StatusOK, chart)
+}
+
+// optionChain answers with the chain of the expiry, which defaults to the nearest expiration.
+// The contracts can be restricted by moneyness and strike range.
+func (h *handlers) optionChain(w http.ResponseWriter, r *http.Request) {
+	symbol, err := symbolParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	expiry, err := timeParam(r, "expiry", time.Time{})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	filter, err := optionFilter(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	chain, err := h.finance.OptionChain(r.Context(), symbol, expiry)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	server.Render(w, r, http.StatusOK, chain.Filter(filter))
+}
+
+func (h *handlers) expirations(w http.ResponseWriter, r *http.Request) {
+	symbol, err := symbolParam(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	expirations, err := h.finance.Expirations(r.Context(), symbol)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	dates := make([]string, 0, len(expirations))
+	for _, expiration := range expirations {
+		dates = append(dates, expiration.Format(time.DateOnly))
+	}
+	server.Render(w, r, http.StatusOK, dates)
+}
+
+func symbolParam(r *http.Request) (string, error) {
+	symbol := chi.URLParam(r, "symbol")
+	if !symbolPattern.MatchString(symbol) {
+		return "", fmt.Errorf("%w: symbol %q", errInvalidParameter, symbol)
+	}
+	return symbol, nil
+}
+
+// timeParam parses a RFC 3339 timestamp or a date, which is midnight UTC.
+func timeParam(r *http.Request, name string, fallback time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %s must be a date or RFC 3339 timestamp", errInvalidParameter, name)
+}
+
+func boolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s must be a boolean", errInvalidParameter, name)
+	}
+	return b, nil
+}
+
+func decimalParam(r *http.Request, name string) (decimal.Decimal, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return decimal.Zero, nil
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil || d.IsNegative() {
+		return decimal.Zero, fmt.Errorf("%w: %s must be a positive number", errInvalidParameter, name)
+	}
+	return d, nil
+}
+
+func optionFilter(r *http.Request) (finance.OptionFilter, error) {
+	var filter finance.OptionFilter
+	var err error
+	switch moneyness := finance.Moneyness(strings.ToLower(r.URL.Query().Get("moneyness"))); moneyness {
+	case finance.AnyMoneyness, finance.InTheMoney, finance.AtTheMoney, finance.OutOfTheMoney:
+		filter.Moneyness = moneyness
+	default:
+		return filter, fmt.Errorf("%w: moneyness must be itm, atm or otm", errInvalidParameter)
+	}
+	if filter.MinStrike, err = decimalParam(r, "minStrike"); err != nil {
+		return filter, err
+	}
+	if filter.MaxStrike, err = decimalParam(r, "maxStrike"); err != nil {
+		return filter, err
+	}
+	if !filter.MaxStrike.IsZero() && filter.MinStrike.GreaterThan(filter.MaxStrike) {
+		return filter, fmt.Errorf("%w: minStrike is greater than maxStrike", errInvalidParameter)
+	}
+	return filter, nil
+}
+
+// writeError answers with the problem of the error. Failed responses aren't cached and the
+// backoff of rate limited backends is reported with Retry-After.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		// the client is gone
+		return
+	}
+	problem := problemOf(err)
+	if problem.Status >= http.StatusInternalServerError {
+		boot.Logger.Warn.Printf("finance api request %s failed: %v", r.URL.Path, err)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if retryAfter, ok := finance.RetryAfter(err); ok && problem.Status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	}
+	server.WriteProblem(w, r, problem)
+}
+
+// problemOf maps the errors of the finance controller to problems. Failures of the backends are
+// answered with 503, when they are rate limited and with 502 otherwise, because the client isn't
+// at fault.
+func problemOf(err error) server.Problem {
+	switch {
+	case errors.Is(err, errInvalidParameter),
+		errors.Is(err, finance.ErrInvalidInterval),
+		errors.Is(err, finance.ErrInvalidRange):
+		return server.NewProblem(http.StatusBadRequest, err.Error())
+	case errors.Is(err, finance.ErrSymbolNotFound):
+		return server.NewProblem(http.StatusNotFound, err.Error())
+	case errors.Is(err, finance.ErrNotSupported):
+		return server.NewProblem(http.StatusNotImplemented, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return server.NewProblem(http.StatusGatewayTimeout, "market data backends didn't answer in time")
+	case errors.Is(err, finance.ErrRateLimited):
+		return server.NewProblem(http.StatusServiceUnavailable, "market data backends are rate limited")
+	case errors.Is(err, finance.ErrUpstreamUnavailable), errors.Is(err, finance.ErrNoBackendAvailable):
+		return server.NewProblem(http.StatusBadGateway, "market data backends are unavailable")
+	default:
+		return server.NewProblem(http.StatusInternalServerError, "market data request failed")
+	}
+}
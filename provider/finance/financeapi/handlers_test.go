@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package financeapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boot-go/stack/provider/finance"
+	"github.com/go-chi/chi/v5"
+)
+
+// fakeFinance answers quotes of known symbols and fails all other symbols with the error.
+type fakeFinance struct {
+	finance.Controller
+	quotes map[string]*finance.Quote
+	err    error
+}
+
+func (f *fakeFinance) QuoteContext(_ context.Context, symbol string) (*finance.Quote, error) {
+	if quote, ok := f.quotes[symbol]; ok {
+		return quote, nil
+	}
+	return nil, f.err
+}
+
+func (f *fakeFinance) Quotes(ctx context.Context, symbols []string) ([]finance.QuoteResult, error) {
+	results := make([]finance.QuoteResult, 0, len(symbols))
+	for _, symbol := range symbols {
+		quote, err := f.QuoteContext(ctx, symbol)
+		results = append(results, finance.QuoteResult{Symbol: symbol, Quote: quote, Err: err})
+	}
+	return results, nil
+}
+
+func (f *fakeFinance) Bars(context.Context, string, finance.Interval, time.Time, time.Time) (*finance.Chart, error) {
+	return nil, f.err
+}
+
+func (f *fakeFinance) OptionChain(context.Context, string, time.Time) (*finance.OptionChain, error) {
+	return nil, f.err
+}
+
+func (f *fakeFinance) Expirations(context.Context, string) ([]time.Time, error) {
+	return []time.Time{time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)}, nil
+}
+
+func newTestRouter(f *fakeFinance) http.Handler {
+	c := &component{Finance: f, MaxAge: 15, MaxSymbols: 3, Timeout: 5}
+	router := chi.NewRouter()
+	router.Route("/finance", c.routes)
+	return router
+}
+
+// serve sends a GET request with the headers, which are given as name value pairs.
+func serve(router http.Handler, path string, headers ...string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Accept", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestRoutes(t *testing.T) {
+	router := newTestRouter(&fakeFinance{
+		quotes: map[string]*finance.Quote{"AAPL": {}},
+		err:    finance.ErrSymbolNotFound,
+	})
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/finance/quotes/AAPL", http.StatusOK},
+		{"/finance/quotes/MSFT", http.StatusNotFound},
+		{"/finance/quotes?symbols=AAPL", http.StatusOK},
+		{"/finance/bars/AAPL", http.StatusNotFound},
+		{"/finance/options/AAPL", http.StatusNotFound},
+		{"/finance/options/AAPL/expirations", http.StatusOK},
+		{"/finance/unknown", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(router, tt.path); w.Code != tt.status {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.status, w.Code)
+		}
+	}
+}
+
+func TestValidation(t *testing.T) {
+	router := newTestRouter(&fakeFinance{err: errors.New("backend must not be called")})
+	paths := []string{
+		"/finance/quotes/AA%20PL",
+		"/finance/quotes?symbols=",
+		"/finance/quotes?symbols=A,B,C,D",
+		"/finance/quotes?symbols=AAPL,MS%2FFT",
+		"/finance/bars/AAPL?from=yesterday",
+		"/finance/bars/AAPL?adjusted=maybe",
+		"/finance/options/AAPL?moneyness=deep",
+		"/finance/options/AAPL?minStrike=-1",
+		"/finance/options/AAPL?minStrike=200&maxStrike=150",
+	}
+	for _, path := range paths {
+		w := serve(router, path)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status 400, got %d", path, w.Code)
+		}
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("GET %s: expected no-store, got %q", path, w.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestQuotesCaching(t *testing.T) {
+	router := newTestRouter(&fakeFinance{
+		quotes: map[string]*finance.Quote{"AAPL": {}, "MSFT": {}},
+		err:    &finance.BackendError{Kind: finance.ErrRateLimited},
+	})
+	w := serve(router, "/finance/quotes?symbols=AAPL,MSFT")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "public, max-age=15" || w.Header().Get("ETag") == "" {
+		t.Errorf("complete results must be cacheable, got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	w = serve(router, "/finance/quotes?symbols=AAPL,IBM")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("ETag") != "" {
+		t.Errorf("partial results must not be cached, got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	var results []quoteResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Problem != nil || results[1].Problem == nil || results[1].Problem.Status != http.StatusServiceUnavailable {
+		t.Errorf("unexpected results %s", w.Body.String())
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	older := time.Date(2024, 1, 19, 15, 30, 0, 0, time.UTC)
+	latest := older.Add(time.Minute)
+	router := newTestRouter(&fakeFinance{
+		quotes: map[string]*finance.Quote{"AAPL": {Time: latest}, "MSFT": {Time: older}},
+		err:    finance.ErrSymbolNotFound,
+	})
+	for _, path := range []string{"/finance/quotes/AAPL", "/finance/quotes?symbols=AAPL,MSFT"} {
+		w := serve(router, path)
+		if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != latest.Format(http.TimeFormat) {
+			t.Errorf("GET %s: expected Last-Modified %s, got %d %q", path, latest.Format(http.TimeFormat), w.Code, w.Header().Get("Last-Modified"))
+		}
+		if w := serve(router, path, "If-Modified-Since", latest.Format(http.TimeFormat)); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("GET %s: expected 304 for an unmodified quote, got %d", path, w.Code)
+		}
+		if w := serve(router, path, "If-Modified-Since", older.Format(http.TimeFormat)); w.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200 for a modified quote, got %d", path, w.Code)
+		}
+	}
+	w := serve(router, "/finance/quotes?symbols=AAPL,IBM", "If-Modified-Since", latest.Format(http.TimeFormat))
+	if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != "" {
+		t.Errorf("partial results must not be conditional, got %d %q", w.Code, w.Header().Get("Last-Modified"))
+	}
+}
+
+func TestProblemOf(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{fmt.Errorf("%w: symbol", errInvalidParameter), http.StatusBadRequest},
+		{finance.ErrInvalidInterval, http.StatusBadRequest},
+		{fmt.Errorf("bars: %w", finance.ErrInvalidRange), http.StatusBadRequest},
+		{finance.ErrSymbolNotFound, http.StatusNotFound},
+		{finance.ErrNotSupported, http.StatusNotImplemented},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{&finance.BackendError{Kind: finance.ErrRateLimited, RetryAfter: time.Second}, http.StatusServiceUnavailable},
+		{&finance.BackendError{Kind: finance.ErrUpstreamUnavailable}, http.StatusBadGateway},
+		{finance.ErrNoBackendAvailable, http.StatusBadGateway},
+		{errors.New("unexpected"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if problem := problemOf(tt.err); problem.Status != tt.status {
+			t.Errorf("%v: expected status %d, got %d", tt.err, tt.status, problem.Status)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	router := newTestRouter(&fakeFinance{err: &finance.BackendError{Kind: finance.ErrRateLimited, RetryAfter: 1500 * time.Millisecond}})
+	w := serve(router, "/finance/quotes/AAPL")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected 503 with Retry-After 2, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/problem+json") {
+		t.Errorf("expected problem response, got %q", w.Header().Get("Content-Type"))
+	}
+}
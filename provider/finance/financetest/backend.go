@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+// Package financetest provides a fake market data backend on a local httptest server. It speaks
+// the GLOBAL_QUOTE protocol of Alpha Vantage, so the alphavantage backend can be pointed at it.
+//
+//	fake := financetest.NewBackend(t)
+//	fake.SetQuote("AAPL", "189.30")
+//	fake.Fail(http.StatusServiceUnavailable)
+//	fake.Throttle()
+package financetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/boot-go/stack/provider/finance"
+)
+
+// APIKey is accepted by the fake backend.
+const APIKey = "financetest"
+
+// Backend is a fake Alpha Vantage backend. Unknown symbols are answered with an empty quote,
+// like the real backend does.
+type Backend struct {
+	server    *httptest.Server
+	mutex     sync.RWMutex
+	quotes    map[string]map[string]string
+	failure   int
+	throttled bool
+	delay     time.Duration
+	requests  atomic.Int64
+	requestID atomic.Value
+}
+
+// NewBackend starts the fake backend, which is closed automatically when the test finishes.
+func NewBackend(t testing.TB) *Backend {
+	t.Helper()
+	b := &Backend{quotes: make(map[string]map[string]string)}
+	b.server = httptest.NewServer(http.HandlerFunc(b.serve))
+	t.Cleanup(b.server.Close)
+	return b
+}
+
+// URL returns the base url of the fake backend.
+func (b *Backend) URL() string {
+	return b.server.URL
+}
+
+// Source returns an alphavantage backend connected to the fake backend.
+func (b *Backend) Source() finance.QuoteSource {
+	source, _ := finance.NewAlphaVantageSource(APIKey, b.server.URL, b.server.Client())
+	return source
+}
+
+// SetQuote sets the price of the symbol. The other fields are derived from the price.
+func (b *Backend) SetQuote(symbol, price string) {
+	b.SetFields(symbol, map[string]string{
+		"02. open":               price,
+		"03. high":               price,
+		"04. low":                price,
+		"05. price":              price,
+		"06. volume":             "0",
+		"07. latest trading day": time.Now().UTC().Format(time.DateOnly),
+		"08. previous close":     price,
+		"09. change":             "0",
+		"10. change percent":     "0%",
+	})
+}
+
+// SetFields sets the raw GLOBAL_QUOTE fields of the symbol, e.g. "05. price".
+func (b *Backend) SetFields(symbol string, fields map[string]string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	quote := map[string]string{"01. symbol": symbol}
+	for key, value := range fields {
+		quote[key] = value
+	}
+	b.quotes[strings.ToUpper(symbol)] = quote
+}
+
+// Fail lets all following requests fail with the status, until Recover is called.
+func (b *Backend) Fail(status int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failure = status
+}
+
+// Throttle answers all following requests with the rate limit note of Alpha Vantage, until
+// Recover is called.
+func (b *Backend) Throttle() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.throttled = true
+}
+
+// Recover lets the requests succeed again.
+func (b *Backend) Recover() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failure = 0
+	b.throttled = false
+}
+
+// Delay delays all following responses, e.g. to test timeouts.
+func (b *Backend) Delay(delay time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.delay = delay
+}
+
+// LastRequestID returns the X-Request-Id header of the last request.
+func (b *Backend) LastRequestID() string {
+	requestID, _ := b.requestID.Load().(string)
+	return requestID
+}
+
+// Requests returns the number of received requests.
+func (b *Backend) Requests() int {
+	return int(b.requests.Load())
+}
+
+func (b *Backend) serve(w http.ResponseWriter, r *http.Request) {
+	b.requests.Add(1)
+	b.requestID.Store(r.Header.Get("X-Request-Id"))
+	b.mutex.RLock()
+	failure, throttled, delay := b.failure, b.throttled, b.delay
+	quote := b.quotes[strings.ToUpper(r.URL.Query().Get("symbol"))]
+	b.mutex.RUnlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failure != 0 {
+		http.Error(w, http.StatusText(failure), failure)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path != "/query" || r.URL.Query().Get("function") != "GLOBAL_QUOTE" {
+		_ = json.NewEncoder(w).Encode(map[string]string{"Error Message": "Invalid API call."})
+		return
+	}
+	if throttled {
+		_ = json.NewEncoder(w).Encode(map[string]string{"Note": "Thank you for using Alpha Vantage! Our standard API call frequency is 5 calls per minute and 500 calls per day."})
+		return
+	}
+	if r.URL.Query().Get("apikey") != APIKey {
+		_ = json.NewEncoder(w).Encode(map[string]string{"Information": "Invalid API key."})
+		return
+	}
+	if quote == nil {
+		quote = map[string]string{}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"Global Quote": quote})
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// InstrumentType classifies the traded asset.
+type InstrumentType string
+
+const (
+	Equity     InstrumentType = "equity"
+	ETF        InstrumentType = "etf"
+	MutualFund InstrumentType = "mutualfund"
+	Index      InstrumentType = "index"
+	Option     InstrumentType = "option"
+	Future     InstrumentType = "future"
+	Currency   InstrumentType = "currency"
+	Crypto     InstrumentType = "crypto"
+)
+
+// MarketState describes the trading session, in which a quote was taken.
+type MarketState string
+
+const (
+	PreMarket     MarketState = "pre"
+	RegularMarket MarketState = "regular"
+	PostMarket    MarketState = "post"
+	MarketClosed  MarketState = "closed"
+)
+
+// Exchange is the venue, where an instrument is traded. The code is the identifier used by the
+// backend, e.g. NMS for Nasdaq.
+type Exchange struct {
+	Code     string `json:"code" xml:"code"`
+	Name     string `json:"name,omitempty" xml:"name,omitempty"`
+	Timezone string `json:"timezone,omitempty" xml:"timezone,omitempty"`
+}
+
+func (e Exchange) String() string {
+	return e.Code
+}
+
+// Location returns the time zone of the exchange or UTC, if it is unknown.
+func (e Exchange) Location() *time.Location {
+	if e.Timezone == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(e.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Money is a decimal amount in an ISO 4217 currency.
+type Money struct {
+	Amount   decimal.Decimal `json:"amount" xml:"amount"`
+	Currency string          `json:"currency" xml:"currency"`
+}
+
+// NewMoney creates money of the amount in the currency.
+func NewMoney(amount decimal.Decimal, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Amount.String()
+	}
+	return m.Amount.String() + " " + m.Currency
+}
+
+// IsZero returns true, if the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount.IsZero()
+}
+
+// Instrument identifies a tradable asset.
+type Instrument struct {
+	Symbol   string         `json:"symbol" xml:"symbol" csv:"symbol"`
+	Name     string         `json:"name,omitempty" xml:"name,omitempty" csv:"name"`
+	Type     InstrumentType `json:"type" xml:"type" csv:"type"`
+	Currency string         `json:"currency" xml:"currency" csv:"currency"`
+	Exchange Exchange       `json:"exchange" xml:"exchange" csv:"exchange"`
+}
+
+// Quote is the latest market data of an instrument. Amounts are decimal to avoid rounding
+// errors of float64.
+type Quote struct {
+	Instrument
+	Price         Money           `json:"price" xml:"price" csv:"price"`
+	Change        decimal.Decimal `json:"change" xml:"change" csv:"change"`
+	ChangePercent decimal.Decimal `json:"changePercent" xml:"changePercent" csv:"changePercent"`
+	Open          Money           `json:"open" xml:"open" csv:"open"`
+	High          Money           `json:"high" xml:"high" csv:"high"`
+	Low           Money           `json:"low" xml:"low" csv:"low"`
+	PreviousClose Money           `json:"previousClose" xml:"previousClose" csv:"previousClose"`
+	Bid           Money           `json:"bid" xml:"bid" csv:"bid"`
+	Ask           Money           `json:"ask" xml:"ask" csv:"ask"`
+	BidSize       int64           `json:"bidSize" xml:"bidSize" csv:"bidSize"`
+	AskSize       int64           `json:"askSize" xml:"askSize" csv:"askSize"`
+	Volume        int64           `json:"volume" xml:"volume" csv:"volume"`
+	MarketState   MarketState     `json:"marketState" xml:"marketState" csv:"marketState"`
+	Time          time.Time       `json:"time" xml:"time" csv:"time"`
+	Source        string          `json:"source,omitempty" xml:"source,omitempty" csv:"source"`
+}
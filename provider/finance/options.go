@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// OptionRight distinguishes calls and puts.
+type OptionRight string
+
+const (
+	Call OptionRight = "call"
+	Put  OptionRight = "put"
+)
+
+// Moneyness describes the strike of a contract relative to the price of the underlying.
+type Moneyness string
+
+const (
+	AnyMoneyness  Moneyness = ""
+	InTheMoney    Moneyness = "itm"
+	AtTheMoney    Moneyness = "atm"
+	OutOfTheMoney Moneyness = "otm"
+)
+
+// OptionContract is a single contract of an option chain. The implied volatility is a fraction,
+// e.g. 0.25 for 25%.
+type OptionContract struct {
+	Symbol            string          `json:"symbol" xml:"symbol" csv:"symbol"`
+	Right             OptionRight     `json:"right" xml:"right" csv:"right"`
+	Strike            Money           `json:"strike" xml:"strike" csv:"strike"`
+	Expiration        time.Time       `json:"expiration" xml:"expiration" csv:"expiration"`
+	Bid               Money           `json:"bid" xml:"bid" csv:"bid"`
+	Ask               Money           `json:"ask" xml:"ask" csv:"ask"`
+	Last              Money           `json:"last" xml:"last" csv:"last"`
+	Change            decimal.Decimal `json:"change" xml:"change" csv:"change"`
+	Volume            int64           `json:"volume" xml:"volume" csv:"volume"`
+	OpenInterest      int64           `json:"openInterest" xml:"openInterest" csv:"openInterest"`
+	ImpliedVolatility decimal.Decimal `json:"impliedVolatility" xml:"impliedVolatility" csv:"impliedVolatility"`
+	LastTrade         time.Time       `json:"lastTrade" xml:"lastTrade" csv:"lastTrade"`
+}
+
+// Moneyness returns the moneyness of the contract at the price of the underlying. Contracts with
+// a strike within the tolerance are at the money, the tolerance is a fraction of the price.
+func (c OptionContract) Moneyness(price, tolerance decimal.Decimal) Moneyness {
+	if price.IsZero() {
+		return AnyMoneyness
+	}
+	if c.Strike.Amount.Sub(price).Abs().LessThanOrEqual(price.Mul(tolerance)) {
+		return AtTheMoney
+	}
+	if (c.Right == Call) == c.Strike.Amount.LessThan(price) {
+		return InTheMoney
+	}
+	return OutOfTheMoney
+}
+
+// Straddle is the call and the put of a strike. Either contract may be missing.
+type Straddle struct {
+	Strike Money           `json:"strike" xml:"strike"`
+	Call   *OptionContract `json:"call,omitempty" xml:"call,omitempty"`
+	Put    *OptionContract `json:"put,omitempty" xml:"put,omitempty"`
+}
+
+// OptionChain contains the calls and puts of an underlying for an expiration, sorted by strike.
+type OptionChain struct {
+	Underlying *Quote           `json:"underlying" xml:"underlying"`
+	Expiration time.Time        `json:"expiration" xml:"expiration"`
+	Calls      []OptionContract `json:"calls" xml:"calls>contract"`
+	Puts       []OptionContract `json:"puts" xml:"puts>contract"`
+	Source     string           `json:"source,omitempty" xml:"source,omitempty"`
+}
+
+// OptionFilter restricts the contracts of a chain. Zero strikes don't limit the range, the
+// tolerance of at the money contracts defaults to 1% of the price of the underlying.
+type OptionFilter struct {
+	MinStrike    decimal.Decimal
+	MaxStrike    decimal.Decimal
+	Moneyness    Moneyness
+	ATMTolerance decimal.Decimal
+}
+
+// defaultATMTolerance is the tolerance of at the money contracts.
+var defaultATMTolerance = decimal.NewFromFloat(0.01)
+
+// Filter returns a chain with the contracts matching the filter.
+func (c *OptionChain) Filter(filter OptionFilter) *OptionChain {
+	tolerance := filter.ATMTolerance
+	if tolerance.IsZero() {
+		tolerance = defaultATMTolerance
+	}
+	price := decimal.Zero
+	if c.Underlying != nil {
+		price = c.Underlying.Price.Amount
+	}
+	matches := func(contract OptionContract) bool {
+		strike := contract.Strike.Amount
+		if !filter.MinStrike.IsZero() && strike.LessThan(filter.MinStrike) {
+			return false
+		}
+		if !filter.MaxStrike.IsZero() && strike.GreaterThan(filter.MaxStrike) {
+			return false
+		}
+		return filter.Moneyness == AnyMoneyness || contract.Moneyness(price, tolerance) == filter.Moneyness
+	}
+	filtered := &OptionChain{
+		Underlying: c.Underlying,
+		Expiration: c.Expiration,
+		Calls:      []OptionContract{},
+		Puts:       []OptionContract{},
+		Source:     c.Source,
+	}
+	for _, contract := range c.Calls {
+		if matches(contract) {
+			filtered.Calls = append(filtered.Calls, contract)
+		}
+	}
+	for _, contract := range c.Puts {
+		if matches(contract) {
+			filtered.Puts = append(filtered.Puts, contract)
+		}
+	}
+	return filtered
+}
+
+// Straddles pairs the calls and puts by strike.
+func (c *OptionChain) Straddles() []Straddle {
+	byStrike := make(map[string]*Straddle)
+	var straddles []*Straddle
+	straddle := func(strike Money) *Straddle {
+		key := strike.Amount.String()
+		if s, ok := byStrike[key]; ok {
+			return s
+		}
+		s := &Straddle{Strike: strike}
+		byStrike[key] = s
+		straddles = append(straddles, s)
+		return s
+	}
+	for i := range c.Calls {
+		straddle(c.Calls[i].Strike).Call = &c.Calls[i]
+	}
+	for i := range c.Puts {
+		straddle(c.Puts[i].Strike).Put = &c.Puts[i]
+	}
+	sort.Slice(straddles, func(i, j int) bool {
+		return straddles[i].Strike.Amount.LessThan(straddles[j].Strike.Amount)
+	})
+	result := make([]Straddle, len(straddles))
+	for i, s := range straddles {
+		result[i] = *s
+	}
+	return result
+}
+
+// OptionSource is a backend providing option chains. A zero expiry selects the nearest
+// expiration.
+type OptionSource interface {
+	Expirations(ctx context.Context, underlying string) ([]time.Time, error)
+	OptionChain(ctx context.Context, underlying string, expiry time.Time) (*OptionChain, error)
+}
+
+// expirationDate returns the expiration as midnight UTC, which is used by the exchanges.
+func expirationDate(expiry time.Time) time.Time {
+	if expiry.IsZero() {
+		return expiry
+	}
+	year, month, day := expiry.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boot-go/boot"
+)
+
+var (
+	// ErrInvalidRateLimit is returned, when FINANCE_RATE_LIMITS can't be parsed.
+	ErrInvalidRateLimit = errors.New("invalid rate limit")
+	errDailyLimit       = errors.New("daily limit exhausted")
+)
+
+// RateLimit is the client-side limit of the requests of a backend. Zero values don't limit.
+type RateLimit struct {
+	PerSecond float64
+	PerDay    int
+}
+
+// parseRateLimits parses comma separated limits of the form backend:perSecond:perDay, e.g.
+// "alphavantage:0.5:500,yahoo:10". Omitted or empty limits don't limit.
+func parseRateLimits(value string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" || len(parts) > 3 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRateLimit, entry)
+		}
+		var limit RateLimit
+		var err error
+		if len(parts) > 1 && strings.TrimSpace(parts[1]) != "" {
+			limit.PerSecond, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			if err != nil || limit.PerSecond < 0 || math.IsInf(limit.PerSecond, 0) || math.IsNaN(limit.PerSecond) {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidRateLimit, entry)
+			}
+		}
+		if len(parts) > 2 && strings.TrimSpace(parts[2]) != "" {
+			limit.PerDay, err = strconv.Atoi(strings.TrimSpace(parts[2]))
+			if err != nil || limit.PerDay < 0 {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidRateLimit, entry)
+			}
+		}
+		limits[name] = limit
+	}
+	return limits, nil
+}
+
+// limiter enforces the rate limit of a backend. The requests per second are a token bucket with a
+// burst of one second, the requests per day are counted per UTC day.
+type limiter struct {
+	mutex  sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	day    time.Time
+	used   int
+	now    func() time.Time
+}
+
+func newLimiter(limit RateLimit) *limiter {
+	return &limiter{limit: limit, tokens: limit.burst(), now: time.Now}
+}
+
+// burst is the number of requests, which may be sent at once.
+func (l RateLimit) burst() float64 {
+	return math.Max(1, math.Ceil(l.PerSecond))
+}
+
+// wait blocks until the request is allowed. ErrRateLimited is returned without waiting, when the
+// daily limit is exhausted. A nil limiter allows all requests.
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	delay, err := l.reserve()
+	if err != nil || delay <= 0 {
+		return err
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a request from the limits and returns the delay until it may be sent.
+func (l *limiter) reserve() (time.Duration, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	if l.limit.PerDay > 0 {
+		today := now.UTC().Truncate(24 * time.Hour)
+		if !today.Equal(l.day) {
+			l.day, l.used = today, 0
+		}
+		if l.used >= l.limit.PerDay {
+			return 0, &BackendError{Kind: ErrRateLimited, RetryAfter: today.Add(24 * time.Hour).Sub(now), Err: errDailyLimit}
+		}
+		l.used++
+	}
+	if l.limit.PerSecond <= 0 {
+		return 0, nil
+	}
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.limit.burst(), l.tokens+now.Sub(l.last).Seconds()*l.limit.PerSecond)
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0, nil
+	}
+	return time.Duration(-l.tokens / l.limit.PerSecond * float64(time.Second)), nil
+}
+
+// cancel returns a reserved request, which wasn't sent.
+func (l *limiter) cancel() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.limit.PerSecond > 0 {
+		l.tokens = math.Min(l.limit.burst(), l.tokens+1)
+	}
+	if l.limit.PerDay > 0 && l.used > 0 {
+		l.used--
+	}
+}
+
+// retryPolicy retries failures with exponential backoff and jitter. A single attempt disables
+// retries.
+type retryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// delay returns the backoff before the retry after the attempt. The backoff of the backend is
+// used, if it is known. False is returned, when it exceeds the max backoff.
+func (p retryPolicy) delay(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if retryAfter > 0 {
+		return retryAfter, retryAfter <= p.maxBackoff
+	}
+	backoff := p.backoff << (attempt - 1)
+	if backoff > p.maxBackoff || backoff <= 0 {
+		backoff = p.maxBackoff
+	}
+	// equal jitter keeps at least half of the backoff
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)), true
+}
+
+// attempt calls the backend within its rate limit and retries retryable failures.
+func attempt[T any](ctx context.Context, f *failover, b *backend, do func() (T, error)) (T, error) {
+	var zero T
+	for n := 1; ; n++ {
+		if err := b.limiter.wait(ctx); err != nil {
+			return zero, err
+		}
+		result, err := do()
+		if err == nil || ctx.Err() != nil {
+			return result, err
+		}
+		err = classify(err)
+		if n >= f.retry.attempts || !retryable(err) {
+			return zero, err
+		}
+		retryAfter, _ := RetryAfter(err)
+		delay, ok := f.retry.delay(n, retryAfter)
+		if !ok {
+			return zero, err
+		}
+		boot.Logger.Debug.Printf("retrying market data backend %s in %s: %v%s", b.name, delay, err, requestSuffix(ctx))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]RateLimit
+		err   bool
+	}{
+		{value: "", want: map[string]RateLimit{}},
+		{value: " , ", want: map[string]RateLimit{}},
+		{value: "yahoo", want: map[string]RateLimit{"yahoo": {}}},
+		{value: "Yahoo:10", want: map[string]RateLimit{"yahoo": {PerSecond: 10}}},
+		{value: "alphavantage:0.5:500, yahoo:10", want: map[string]RateLimit{"alphavantage": {PerSecond: 0.5, PerDay: 500}, "yahoo": {PerSecond: 10}}},
+		{value: "alphavantage::500", want: map[string]RateLimit{"alphavantage": {PerDay: 500}}},
+		{value: " file : 1 : 2 ", want: map[string]RateLimit{"file": {PerSecond: 1, PerDay: 2}}},
+		{value: ":1", err: true},
+		{value: "yahoo:1:2:3", err: true},
+		{value: "yahoo:fast", err: true},
+		{value: "yahoo:-1", err: true},
+		{value: "yahoo:NaN", err: true},
+		{value: "yahoo:Inf", err: true},
+		{value: "yahoo:1:1.5", err: true},
+		{value: "yahoo:1:-1", err: true},
+		{value: "yahoo:1,:2", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			limits, err := parseRateLimits(test.value)
+			if test.err {
+				if !errors.Is(err, ErrInvalidRateLimit) {
+					t.Errorf("expected ErrInvalidRateLimit, got %v", err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(limits, test.want) {
+				t.Errorf("expected %v, got %v %v", test.want, limits, err)
+			}
+		})
+	}
+}
+
+// testLimiter returns a limiter with a manually advanced clock.
+func testLimiter(limit RateLimit, now *time.Time) *limiter {
+	l := newLimiter(limit)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := testLimiter(RateLimit{PerSecond: 2}, &now)
+	steps := []struct {
+		advance time.Duration
+		delay   time.Duration
+	}{
+		{0, 0},
+		{0, 0}, // burst of one second
+		{0, 500 * time.Millisecond},
+		{0, time.Second},
+		{2 * time.Second, 0}, // the bucket refilled the reserved and the burst tokens
+		{0, 0},
+		{0, 500 * time.Millisecond},
+		{10 * time.Second, 0}, // the bucket is limited by the burst
+		{0, 0},
+		{0, 500 * time.Millisecond},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		delay, err := l.reserve()
+		if err != nil || delay != step.delay {
+			t.Errorf("step %d: expected a delay of %s, got %s %v", i, step.delay, delay, err)
+		}
+	}
+	l.cancel()
+	if delay, _ := l.reserve(); delay != 500*time.Millisecond {
+		t.Errorf("expected a canceled request to return its token, got a delay of %s", delay)
+	}
+}
+
+func TestLimiterDailyLimit(t *testing.T) {
+	now := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	l := testLimiter(RateLimit{PerDay: 2}, &now)
+	for i := 0; i < 2; i++ {
+		if _, err := l.reserve(); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+	_, err := l.reserve()
+	if !errors.Is(err, ErrRateLimited) || !errors.Is(err, errDailyLimit) || retryable(err) {
+		t.Fatalf("expected the exhausted daily limit, got %v", err)
+	}
+	if retryAfter, ok := RetryAfter(err); !ok || retryAfter != 6*time.Hour {
+		t.Errorf("expected to retry at midnight UTC, got %s", retryAfter)
+	}
+	l.cancel()
+	if _, err := l.reserve(); err != nil {
+		t.Errorf("expected a canceled request to be returned to the daily limit, got %v", err)
+	}
+	now = now.Add(6 * time.Hour)
+	if _, err := l.reserve(); err != nil {
+		t.Errorf("expected the daily limit to reset at midnight UTC, got %v", err)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	var l *limiter
+	if err := l.wait(context.Background()); err != nil {
+		t.Errorf("expected a nil limiter to allow all requests, got %v", err)
+	}
+	l = newLimiter(RateLimit{PerSecond: 1})
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to stop with the context, got %v", err)
+	}
+	if l.tokens < -0.1 {
+		t.Errorf("expected the canceled request to return its token, got %f tokens", l.tokens)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := retryPolicy{attempts: 3, backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		min, max   time.Duration
+		ok         bool
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond, ok: true},
+		{attempt: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond, ok: true},
+		{attempt: 4, min: 400 * time.Millisecond, max: 800 * time.Millisecond, ok: true},
+		{attempt: 5, min: 500 * time.Millisecond, max: time.Second, ok: true},
+		{attempt: 64, min: 500 * time.Millisecond, max: time.Second, ok: true},
+		{attempt: 1, retryAfter: 300 * time.Millisecond, min: 300 * time.Millisecond, max: 300 * time.Millisecond, ok: true},
+		{attempt: 1, retryAfter: 2 * time.Second, min: 2 * time.Second, max: 2 * time.Second, ok: false},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			delay, ok := policy.delay(test.attempt, test.retryAfter)
+			if ok != test.ok || delay < test.min || delay > test.max {
+				t.Fatalf("attempt %d after %s: expected %s to %s, got %s %t", test.attempt, test.retryAfter, test.min, test.max, delay, ok)
+			}
+		}
+	}
+}
+
+func TestAttemptRetryAfter(t *testing.T) {
+	f := &failover{retry: retryPolicy{attempts: 3, backoff: time.Hour, maxBackoff: time.Second}}
+	b := &backend{name: "test"}
+	calls := 0
+	start := time.Now()
+	result, err := attempt(context.Background(), f, b, func() (string, error) {
+		calls++
+		if calls == 1 {
+			return "", &BackendError{Kind: ErrRateLimited, RetryAfter: 20 * time.Millisecond}
+		}
+		return "ok", nil
+	})
+	if err != nil || result != "ok" || calls != 2 {
+		t.Fatalf("expected a successful retry, got %q %v after %d calls", result, err, calls)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected the retry after the Retry-After of the backend instead of the backoff, got %s", elapsed)
+	}
+
+	calls = 0
+	_, err = attempt(context.Background(), f, b, func() (string, error) {
+		calls++
+		return "", &BackendError{Kind: ErrRateLimited, RetryAfter: time.Minute}
+	})
+	if !errors.Is(err, ErrRateLimited) || calls != 1 {
+		t.Errorf("expected no retry, when the Retry-After exceeds the max backoff, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	_, err = attempt(context.Background(), f, b, func() (string, error) {
+		calls++
+		return "", errors.New("invalid response")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected no retry of permanent failures, got %d calls", calls)
+	}
+}
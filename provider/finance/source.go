@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+)
+
+// QuoteSource is a backend providing market data. The backend converts its data into the
+// provider-agnostic model, so backends can be replaced without changing any caller.
+type QuoteSource interface {
+	Quote(ctx context.Context, symbol string) (*Quote, error)
+}
+
+// BatchQuoteSource is a backend, which fetches the quotes of many symbols with one upstream
+// request. The batch size is the upstream limit of symbols per request. The quotes are keyed by
+// the upper case symbol, symbols missing in the result are treated as unknown.
+type BatchQuoteSource interface {
+	QuoteSource
+	BatchSize() int
+	Quotes(ctx context.Context, symbols []string) (map[string]*Quote, error)
+}
+
+// QuoteResult is the result of a symbol of a batch. Either the quote or the error is set.
+type QuoteResult struct {
+	Symbol string
+	Quote  *Quote
+	Err    error
+}
+
+// chunk splits the symbols into chunks of the size.
+func chunk(symbols []string, size int) [][]string {
+	if size < 1 {
+		size = 1
+	}
+	var chunks [][]string
+	for len(symbols) > size {
+		chunks = append(chunks, symbols[:size:size])
+		symbols = symbols[size:]
+	}
+	if len(symbols) > 0 {
+		chunks = append(chunks, symbols)
+	}
+	return chunks
+}
@@ -0,0 +1,597 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package finance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piquette/finance-go"
+	"github.com/piquette/finance-go/form"
+	"github.com/piquette/finance-go/quote"
+	"github.com/shopspring/decimal"
+)
+
+// yahooBatchSize is the number of symbols requested at once. Yahoo Finance rejects urls, which
+// are too long.
+const yahooBatchSize = 50
+
+// yahooSource provides quotes of Yahoo Finance using finance-go. The chart isn't requested with
+// finance-go, because it doesn't support dividends and splits.
+type yahooSource struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewYahooSource creates the quote source backed by Yahoo Finance.
+func NewYahooSource() QuoteSource {
+	return &yahooSource{
+		baseURL: finance.YFinURL,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (y *yahooSource) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	iter := quote.ListP(&quote.Params{
+		Params:  finance.Params{Context: &ctx},
+		Symbols: []string{symbol},
+	})
+	if !iter.Next() {
+		if err := iter.Err(); err != nil {
+			return nil, yahooError(err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+	}
+	return fromYahooQuote(iter.Quote()), nil
+}
+
+func (y *yahooSource) BatchSize() int {
+	return yahooBatchSize
+}
+
+func (y *yahooSource) Quotes(ctx context.Context, symbols []string) (map[string]*Quote, error) {
+	iter := quote.ListP(&quote.Params{
+		Params:  finance.Params{Context: &ctx},
+		Symbols: symbols,
+	})
+	quotes := make(map[string]*Quote, len(symbols))
+	for iter.Next() {
+		q := iter.Quote()
+		quotes[strings.ToUpper(q.Symbol)] = fromYahooQuote(q)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, yahooError(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return quotes, nil
+}
+
+// yahooError classifies the errors of finance-go. It reports failed responses as remote errors
+// without status, so throttling can't be told apart from other failures.
+func yahooError(err error) error {
+	if strings.Contains(err.Error(), "code: remote-error") {
+		return &BackendError{Kind: ErrUpstreamUnavailable, Err: err}
+	}
+	return err
+}
+
+var yahooInstrumentTypes = map[finance.QuoteType]InstrumentType{
+	finance.QuoteTypeEquity:     Equity,
+	finance.QuoteTypeETF:        ETF,
+	finance.QuoteTypeMutualFund: MutualFund,
+	finance.QuoteTypeIndex:      Index,
+	finance.QuoteTypeOption:     Option,
+	finance.QuoteTypeFuture:     Future,
+	finance.QuoteTypeForexPair:  Currency,
+	finance.QuoteTypeCryptoPair: Crypto,
+}
+
+var yahooMarketStates = map[finance.MarketState]MarketState{
+	finance.MarketStatePrePre:   PreMarket,
+	finance.MarketStatePre:      PreMarket,
+	finance.MarketStateRegular:  RegularMarket,
+	finance.MarketStatePost:     PostMarket,
+	finance.MarketStatePostPost: PostMarket,
+	finance.MarketStateClosed:   MarketClosed,
+}
+
+// fromYahooQuote converts the quote of finance-go. The float64 values are converted with their
+// shortest representation, so 0.1 stays 0.1.
+func fromYahooQuote(q *finance.Quote) *Quote {
+	money := func(amount float64) Money {
+		return NewMoney(decimal.NewFromFloat(amount), q.CurrencyID)
+	}
+	exchange := Exchange{
+		Code:     q.ExchangeID,
+		Name:     q.FullExchangeName,
+		Timezone: q.ExchangeTimezoneName,
+	}
+	result := &Quote{
+		Instrument: Instrument{
+			Symbol:   q.Symbol,
+			Name:     q.ShortName,
+			Type:     yahooInstrumentTypes[q.QuoteType],
+			Currency: q.CurrencyID,
+			Exchange: exchange,
+		},
+		Price:         money(q.RegularMarketPrice),
+		Change:        decimal.NewFromFloat(q.RegularMarketChange),
+		ChangePercent: decimal.NewFromFloat(q.RegularMarketChangePercent),
+		Open:          money(q.RegularMarketOpen),
+		High:          money(q.RegularMarketDayHigh),
+		Low:           money(q.RegularMarketDayLow),
+		PreviousClose: money(q.RegularMarketPreviousClose),
+		Bid:           money(q.Bid),
+		Ask:           money(q.Ask),
+		BidSize:       int64(q.BidSize),
+		AskSize:       int64(q.AskSize),
+		Volume:        int64(q.RegularMarketVolume),
+		MarketState:   yahooMarketStates[q.MarketState],
+		Source:        "yahoo",
+	}
+	if q.RegularMarketTime != 0 {
+		result.Time = time.Unix(int64(q.RegularMarketTime), 0).In(exchange.Location())
+	}
+	return result
+}
+
+// yahooChart is the response of the chart api. Prices of incomplete bars are null.
+type yahooChart struct {
+	Chart struct {
+		Result []struct {
+			Meta struct {
+				Currency             string            `json:"currency"`
+				Symbol               string            `json:"symbol"`
+				ShortName            string            `json:"shortName"`
+				ExchangeName         string            `json:"exchangeName"`
+				FullExchangeName     string            `json:"fullExchangeName"`
+				InstrumentType       finance.QuoteType `json:"instrumentType"`
+				ExchangeTimezoneName string            `json:"exchangeTimezoneName"`
+			} `json:"meta"`
+			Timestamp []int64 `json:"timestamp"`
+			Events    struct {
+				Dividends map[string]struct {
+					Amount float64 `json:"amount"`
+					Date   int64   `json:"date"`
+				} `json:"dividends"`
+				Splits map[string]struct {
+					Date        int64   `json:"date"`
+					Numerator   float64 `json:"numerator"`
+					Denominator float64 `json:"denominator"`
+				} `json:"splits"`
+			} `json:"events"`
+			Indicators struct {
+				Quote []struct {
+					Open   []*float64 `json:"open"`
+					High   []*float64 `json:"high"`
+					Low    []*float64 `json:"low"`
+					Close  []*float64 `json:"close"`
+					Volume []*int64   `json:"volume"`
+				} `json:"quote"`
+				AdjClose []struct {
+					AdjClose []*float64 `json:"adjclose"`
+				} `json:"adjclose"`
+			} `json:"indicators"`
+		} `json:"result"`
+		Error *finance.YfinError `json:"error"`
+	} `json:"chart"`
+}
+
+func (y *yahooSource) Bars(ctx context.Context, symbol string, interval Interval, from, to time.Time) (*Chart, error) {
+	query := url.Values{}
+	query.Set("interval", string(interval))
+	query.Set("period1", strconv.FormatInt(from.Unix(), 10))
+	query.Set("period2", strconv.FormatInt(to.Unix(), 10))
+	query.Set("events", "div,splits")
+	query.Set("includeAdjustedClose", "true")
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, y.baseURL+"/v8/finance/chart/"+url.PathEscape(symbol)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", "Mozilla/5.0")
+	response, err := y.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var result yahooChart
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("yahoo: %w", statusError(response))
+		}
+		return nil, fmt.Errorf("yahoo: invalid response: %w", err)
+	}
+	if e := result.Chart.Error; e != nil {
+		if e.Code == "Not Found" {
+			return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+		}
+		return nil, fmt.Errorf("yahoo: %s: %s", e.Code, e.Description)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("yahoo: %w", statusError(response))
+	}
+	if len(result.Chart.Result) == 0 {
+		return nil, errors.New("yahoo: empty chart")
+	}
+	return fromYahooChart(&result, interval), nil
+}
+
+// fromYahooChart converts the chart. Bars without close are skipped, they belong to a running
+// interval or a trading halt.
+func fromYahooChart(result *yahooChart, interval Interval) *Chart {
+	data := result.Chart.Result[0]
+	meta := data.Meta
+	exchange := Exchange{
+		Code:     meta.ExchangeName,
+		Name:     meta.FullExchangeName,
+		Timezone: meta.ExchangeTimezoneName,
+	}
+	location := exchange.Location()
+	chart := &Chart{
+		Instrument: Instrument{
+			Symbol:   meta.Symbol,
+			Name:     meta.ShortName,
+			Type:     yahooInstrumentTypes[meta.InstrumentType],
+			Currency: meta.Currency,
+			Exchange: exchange,
+		},
+		Interval:  interval,
+		Bars:      []Bar{},
+		Dividends: []Dividend{},
+		Splits:    []Split{},
+		Source:    "yahoo",
+	}
+	value := func(values []*float64, i int) decimal.Decimal {
+		if i >= len(values) || values[i] == nil {
+			return decimal.Zero
+		}
+		return decimal.NewFromFloat(*values[i])
+	}
+	if len(data.Indicators.Quote) > 0 {
+		quote := data.Indicators.Quote[0]
+		var adjClose []*float64
+		if len(data.Indicators.AdjClose) > 0 {
+			adjClose = data.Indicators.AdjClose[0].AdjClose
+		}
+		for i, timestamp := range data.Timestamp {
+			if i >= len(quote.Close) || quote.Close[i] == nil {
+				continue
+			}
+			bar := Bar{
+				Time:          time.Unix(timestamp, 0).In(location),
+				Open:          value(quote.Open, i),
+				High:          value(quote.High, i),
+				Low:           value(quote.Low, i),
+				Close:         value(quote.Close, i),
+				AdjustedClose: value(adjClose, i),
+			}
+			if i < len(quote.Volume) && quote.Volume[i] != nil {
+				bar.Volume = *quote.Volume[i]
+			}
+			chart.Bars = append(chart.Bars, bar)
+		}
+	}
+	for _, dividend := range data.Events.Dividends {
+		chart.Dividends = append(chart.Dividends, Dividend{
+			Time:   time.Unix(dividend.Date, 0).In(location),
+			Amount: NewMoney(decimal.NewFromFloat(dividend.Amount), meta.Currency),
+		})
+	}
+	sort.Slice(chart.Dividends, func(i, j int) bool {
+		return chart.Dividends[i].Time.Before(chart.Dividends[j].Time)
+	})
+	for _, split := range data.Events.Splits {
+		chart.Splits = append(chart.Splits, Split{
+			Time:        time.Unix(split.Date, 0).In(location),
+			Numerator:   decimal.NewFromFloat(split.Numerator),
+			Denominator: decimal.NewFromFloat(split.Denominator),
+		})
+	}
+	sort.Slice(chart.Splits, func(i, j int) bool {
+		return chart.Splits[i].Time.Before(chart.Splits[j].Time)
+	})
+	return chart
+}
+
+// yahooDetails contains the class-specific fields of the quote api, which finance-go only
+// provides with one package per asset class.
+type yahooDetails struct {
+	finance.Quote
+	EpsTrailingTwelveMonths      float64 `json:"epsTrailingTwelveMonths"`
+	EpsForward                   float64 `json:"epsForward"`
+	TrailingPE                   float64 `json:"trailingPE"`
+	ForwardPE                    float64 `json:"forwardPE"`
+	TrailingAnnualDividendRate   float64 `json:"trailingAnnualDividendRate"`
+	TrailingAnnualDividendYield  float64 `json:"trailingAnnualDividendYield"`
+	BookValue                    float64 `json:"bookValue"`
+	PriceToBook                  float64 `json:"priceToBook"`
+	SharesOutstanding            float64 `json:"sharesOutstanding"`
+	MarketCap                    float64 `json:"marketCap"`
+	EarningsTimestamp            int64   `json:"earningsTimestamp"`
+	NavPrice                     float64 `json:"navPrice"`
+	YTDReturn                    float64 `json:"ytdReturn"`
+	TrailingThreeMonthReturns    float64 `json:"trailingThreeMonthReturns"`
+	TrailingThreeMonthNavReturns float64 `json:"trailingThreeMonthNavReturns"`
+	TotalAssets                  float64 `json:"totalAssets"`
+	FromCurrency                 string  `json:"fromCurrency"`
+	ToCurrency                   string  `json:"toCurrency"`
+	CirculatingSupply            float64 `json:"circulatingSupply"`
+	MaxSupply                    float64 `json:"maxSupply"`
+	Volume24Hr                   float64 `json:"volume24Hr"`
+	UnderlyingSymbol             string  `json:"underlyingSymbol"`
+	OpenInterest                 float64 `json:"openInterest"`
+	ExpireDate                   int64   `json:"expireDate"`
+	Strike                       float64 `json:"strike"`
+}
+
+type yahooDetailsResponse struct {
+	QuoteResponse struct {
+		Result []*yahooDetails    `json:"result"`
+		Error  *finance.YfinError `json:"error"`
+	} `json:"quoteResponse"`
+}
+
+func (y *yahooSource) Asset(ctx context.Context, symbol string) (Asset, error) {
+	body := &form.Values{}
+	body.Set("symbols", symbol)
+	var response yahooDetailsResponse
+	err := finance.GetBackend(finance.YFinBackend).Call("/v6/finance/quote", body, &ctx, &response)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, yahooError(err)
+	}
+	if response.QuoteResponse.Error != nil {
+		return nil, response.QuoteResponse.Error
+	}
+	for _, details := range response.QuoteResponse.Result {
+		if details != nil && strings.EqualFold(details.Symbol, symbol) {
+			return fromYahooDetails(details), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+}
+
+// fromYahooDetails converts the quote into the quote of its asset class.
+func fromYahooDetails(d *yahooDetails) Asset {
+	q := fromYahooQuote(&d.Quote)
+	money := func(amount float64) Money {
+		return NewMoney(decimal.NewFromFloat(amount), d.CurrencyID)
+	}
+	unix := func(seconds int64) time.Time {
+		if seconds == 0 {
+			return time.Time{}
+		}
+		return time.Unix(seconds, 0).In(q.Exchange.Location())
+	}
+	switch q.Type {
+	case Equity:
+		return &EquityQuote{
+			Quote:             *q,
+			EPS:               decimal.NewFromFloat(d.EpsTrailingTwelveMonths),
+			ForwardEPS:        decimal.NewFromFloat(d.EpsForward),
+			PE:                decimal.NewFromFloat(d.TrailingPE),
+			ForwardPE:         decimal.NewFromFloat(d.ForwardPE),
+			DividendRate:      money(d.TrailingAnnualDividendRate),
+			DividendYield:     decimal.NewFromFloat(d.TrailingAnnualDividendYield),
+			BookValue:         money(d.BookValue),
+			PriceToBook:       decimal.NewFromFloat(d.PriceToBook),
+			SharesOutstanding: int64(d.SharesOutstanding),
+			MarketCap:         money(d.MarketCap),
+			EarningsDate:      unix(d.EarningsTimestamp),
+		}
+	case ETF, MutualFund:
+		return &FundQuote{
+			Quote:               *q,
+			NAV:                 money(d.NavPrice),
+			YTDReturn:           decimal.NewFromFloat(d.YTDReturn),
+			ThreeMonthReturn:    decimal.NewFromFloat(d.TrailingThreeMonthReturns),
+			ThreeMonthNAVReturn: decimal.NewFromFloat(d.TrailingThreeMonthNavReturns),
+			TotalAssets:         money(d.TotalAssets),
+		}
+	case Currency:
+		base, quoteCurrency := yahooCurrencyPair(d.Symbol, d.CurrencyID)
+		return &CurrencyPairQuote{Quote: *q, BaseCurrency: base, QuoteCurrency: quoteCurrency}
+	case Crypto:
+		base, quoteCurrency := d.FromCurrency, strings.TrimSuffix(d.ToCurrency, "=X")
+		if base == "" {
+			base, _, _ = strings.Cut(d.Symbol, "-")
+		}
+		if quoteCurrency == "" {
+			quoteCurrency = d.CurrencyID
+		}
+		return &CryptoQuote{
+			Quote:             *q,
+			BaseCurrency:      base,
+			QuoteCurrency:     quoteCurrency,
+			CirculatingSupply: int64(d.CirculatingSupply),
+			MaxSupply:         int64(d.MaxSupply),
+			Volume24h:         int64(d.Volume24Hr),
+			MarketCap:         money(d.MarketCap),
+		}
+	case Future:
+		return &FutureQuote{
+			Quote:        *q,
+			Underlying:   d.UnderlyingSymbol,
+			OpenInterest: int64(d.OpenInterest),
+			Expiration:   unix(d.ExpireDate),
+		}
+	case Option:
+		return &OptionQuote{
+			Quote:        *q,
+			Underlying:   d.UnderlyingSymbol,
+			OpenInterest: int64(d.OpenInterest),
+			Expiration:   unix(d.ExpireDate),
+			Strike:       money(d.Strike),
+		}
+	default:
+		return q
+	}
+}
+
+// yahooCurrencyPair derives the currencies of forex symbols like EURUSD=X. Symbols with a single
+// currency like JPY=X are quoted against USD.
+func yahooCurrencyPair(symbol, currency string) (string, string) {
+	pair := strings.TrimSuffix(strings.ToUpper(symbol), "=X")
+	switch len(pair) {
+	case 6:
+		return pair[:3], pair[3:]
+	case 3:
+		return "USD", pair
+	default:
+		return "", currency
+	}
+}
+
+// yahooOptions is the response of the options api.
+type yahooOptions struct {
+	OptionChain struct {
+		Result []struct {
+			UnderlyingSymbol string         `json:"underlyingSymbol"`
+			ExpirationDates  []int64        `json:"expirationDates"`
+			Quote            *finance.Quote `json:"quote"`
+			Options          []struct {
+				ExpirationDate int64               `json:"expirationDate"`
+				Calls          []*finance.Contract `json:"calls"`
+				Puts           []*finance.Contract `json:"puts"`
+			} `json:"options"`
+		} `json:"result"`
+		Error *finance.YfinError `json:"error"`
+	} `json:"optionChain"`
+}
+
+// options requests the options api. finance-go isn't used, because it panics for unknown
+// underlyings.
+func (y *yahooSource) options(ctx context.Context, underlying string, expiry time.Time) (*yahooOptions, error) {
+	body := &form.Values{}
+	if !expiry.IsZero() {
+		body.Set("date", strconv.FormatInt(expiry.Unix(), 10))
+	}
+	var response yahooOptions
+	err := finance.GetBackend(finance.YFinBackend).Call("/v6/finance/options/"+url.PathEscape(underlying), body, &ctx, &response)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, yahooError(err)
+	}
+	if response.OptionChain.Error != nil {
+		return nil, response.OptionChain.Error
+	}
+	if len(response.OptionChain.Result) == 0 || response.OptionChain.Result[0].Quote == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, underlying)
+	}
+	return &response, nil
+}
+
+func (y *yahooSource) Expirations(ctx context.Context, underlying string) ([]time.Time, error) {
+	response, err := y.options(ctx, underlying, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	var expirations []time.Time
+	for _, expiration := range response.OptionChain.Result[0].ExpirationDates {
+		expirations = append(expirations, time.Unix(expiration, 0).UTC())
+	}
+	sort.Slice(expirations, func(i, j int) bool {
+		return expirations[i].Before(expirations[j])
+	})
+	return expirations, nil
+}
+
+func (y *yahooSource) OptionChain(ctx context.Context, underlying string, expiry time.Time) (*OptionChain, error) {
+	response, err := y.options(ctx, underlying, expiry)
+	if err != nil {
+		return nil, err
+	}
+	result := response.OptionChain.Result[0]
+	chain := &OptionChain{
+		Underlying: fromYahooQuote(result.Quote),
+		Expiration: expiry,
+		Calls:      []OptionContract{},
+		Puts:       []OptionContract{},
+		Source:     "yahoo",
+	}
+	if len(result.Options) == 0 {
+		return chain, nil
+	}
+	options := result.Options[0]
+	chain.Expiration = time.Unix(options.ExpirationDate, 0).UTC()
+	for _, contract := range options.Calls {
+		chain.Calls = append(chain.Calls, fromYahooContract(contract, Call, chain.Expiration))
+	}
+	for _, contract := range options.Puts {
+		chain.Puts = append(chain.Puts, fromYahooContract(contract, Put, chain.Expiration))
+	}
+	byStrike := func(contracts []OptionContract) func(i, j int) bool {
+		return func(i, j int) bool {
+			return contracts[i].Strike.Amount.LessThan(contracts[j].Strike.Amount)
+		}
+	}
+	sort.SliceStable(chain.Calls, byStrike(chain.Calls))
+	sort.SliceStable(chain.Puts, byStrike(chain.Puts))
+	return chain, nil
+}
+
+// fromYahooContract converts the contract, the expiration of the chain is used, if the contract
+// has none.
+func fromYahooContract(c *finance.Contract, right OptionRight, expiration time.Time) OptionContract {
+	money := func(amount float64) Money {
+		return NewMoney(decimal.NewFromFloat(amount), c.Currency)
+	}
+	contract := OptionContract{
+		Symbol:            c.Symbol,
+		Right:             right,
+		Strike:            money(c.Strike),
+		Expiration:        expiration,
+		Bid:               money(c.Bid),
+		Ask:               money(c.Ask),
+		Last:              money(c.LastPrice),
+		Change:            decimal.NewFromFloat(c.Change),
+		Volume:            int64(c.Volume),
+		OpenInterest:      int64(c.OpenInterest),
+		ImpliedVolatility: decimal.NewFromFloat(c.ImpliedVolatility),
+	}
+	if c.Expiration != 0 {
+		contract.Expiration = time.Unix(int64(c.Expiration), 0).UTC()
+	}
+	if c.LastTradeDate != 0 {
+		contract.LastTrade = time.Unix(int64(c.LastTradeDate), 0).UTC()
+	}
+	return contract
+}
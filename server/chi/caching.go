@@ -0,0 +1,326 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachePolicy describes the Cache-Control header, which is applied to a route.
+type CachePolicy struct {
+	// MaxAge sets max-age, zero omits the directive.
+	MaxAge time.Duration
+	// SharedMaxAge sets s-maxage for shared caches like proxies and CDNs.
+	SharedMaxAge time.Duration
+	// StaleWhileRevalidate allows caches to serve stale responses while revalidating.
+	StaleWhileRevalidate time.Duration
+	Public               bool
+	Private              bool
+	NoCache              bool
+	NoStore              bool
+	MustRevalidate       bool
+	Immutable            bool
+}
+
+// String returns the Cache-Control header value of the policy.
+func (p CachePolicy) String() string {
+	var directives []string
+	if p.NoStore {
+		return "no-store"
+	}
+	if p.Public {
+		directives = append(directives, "public")
+	} else if p.Private {
+		directives = append(directives, "private")
+	}
+	if p.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	if p.MaxAge > 0 {
+		directives = append(directives, "max-age="+seconds(p.MaxAge))
+	}
+	if p.SharedMaxAge > 0 {
+		directives = append(directives, "s-maxage="+seconds(p.SharedMaxAge))
+	}
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(p.StaleWhileRevalidate))
+	}
+	if p.MustRevalidate {
+		directives = append(directives, "must-revalidate")
+	}
+	if p.Immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// CacheControl returns a middleware, which sets the Cache-Control header of the given policy
+// on every response. Handlers may still override the header.
+func CacheControl(policy CachePolicy) func(http.Handler) http.Handler {
+	value := policy.String()
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if value != "" {
+				w.Header().Set("Cache-Control", value)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// addVary adds the request headers to the Vary header, unless they are listed already.
+func addVary(header http.Header, names ...string) {
+	listed := responseVary(header)
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if i := sort.SearchStrings(listed, name); i < len(listed) && listed[i] == name {
+			continue
+		}
+		header.Add("Vary", name)
+	}
+}
+
+// StrongETag returns a strong entity tag of the given content.
+func StrongETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag returns a weak entity tag of the given content.
+func WeakETag(content []byte) string {
+	return "W/" + StrongETag(content)
+}
+
+// ETag returns a middleware, which buffers successful GET and HEAD responses and adds an entity
+// tag to GET responses, if the handler didn't set one. HEAD responses have no body to derive the
+// tag from, so only the tag of the handler is used. Conditional requests are answered with
+// 304 Not Modified when either If-None-Match or If-Modified-Since matches. Other responses, responses with
+// no-store and flushed responses are passed through without buffering, WebSocket upgrades and
+// event streams aren't touched at all.
+func ETag(weak bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || streamingRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ew := &etagWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(ew, r)
+			if ew.passthrough {
+				return
+			}
+			header := w.Header()
+			if header.Get("ETag") == "" && r.Method == http.MethodGet {
+				if weak {
+					header.Set("ETag", WeakETag(ew.body.Bytes()))
+				} else {
+					header.Set("ETag", StrongETag(ew.body.Bytes()))
+				}
+			}
+			if !modified(r, header) {
+				writeNotModified(w)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(ew.body.Bytes())
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// CheckETag sets the ETag header and returns false after answering with 304 Not Modified, if the
+// request contains a matching If-None-Match header. Handlers must not write the body in this case.
+func CheckETag(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if modified(r, w.Header()) {
+		return true
+	}
+	writeNotModified(w)
+	return false
+}
+
+// CheckLastModified sets the Last-Modified header and returns false after answering with
+// 304 Not Modified, if the resource wasn't modified since the time requested by
+// If-Modified-Since. Handlers must not write the body in this case.
+func CheckLastModified(w http.ResponseWriter, r *http.Request, lastModified time.Time) bool {
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if modified(r, w.Header()) {
+		return true
+	}
+	writeNotModified(w)
+	return false
+}
+
+// modified evaluates the conditional request headers against the response headers. The
+// If-None-Match header takes precedence over If-Modified-Since as described in RFC 9110.
+func modified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return true
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return true
+		}
+		return !etagMatches(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+		if err != nil {
+			return true
+		}
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return true
+		}
+		return lastModified.Truncate(time.Second).After(since)
+	}
+	return true
+}
+
+// etagMatches uses the weak comparison, which is required for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// etagWriter buffers a successful response until it is complete. It switches to pass through as
+// soon as the response turns out to be not cacheable or the handler flushes it.
+type etagWriter struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+	passthrough bool
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	ew.status = status
+	if status != http.StatusOK || cacheDirectives(ew.Header())["no-store"] {
+		ew.passthrough = true
+		ew.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	ew.WriteHeader(http.StatusOK)
+	if ew.passthrough {
+		return ew.ResponseWriter.Write(b)
+	}
+	return ew.body.Write(b)
+}
+
+// Flush writes the buffered response, the remaining response is passed through.
+func (ew *etagWriter) Flush() {
+	ew.WriteHeader(http.StatusOK)
+	if !ew.passthrough {
+		ew.passthrough = true
+		ew.ResponseWriter.WriteHeader(ew.status)
+		_, _ = ew.ResponseWriter.Write(ew.body.Bytes())
+		ew.body.Reset()
+	}
+	if flusher, ok := ew.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (ew *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := ew.ResponseWriter.(http.Hijacker); ok {
+		ew.passthrough = true
+		return hijacker.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap returns the original writer for http.ResponseController.
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// bufferedWriter keeps the complete response in memory, so it can be inspected before it
+// is written to the client.
+type bufferedWriter struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func newBufferedWriter() *bufferedWriter {
+	return &bufferedWriter{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	if bw.wroteHeader {
+		return
+	}
+	bw.wroteHeader = true
+	bw.status = status
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	bw.WriteHeader(http.StatusOK)
+	return bw.body.Write(b)
+}
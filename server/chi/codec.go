@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JSONCodec encodes values as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+func (JSONCodec) Encode(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// XMLCodec encodes values as XML. Slices are wrapped in an items element, because XML requires
+// a single root element.
+type XMLCodec struct{}
+
+func (XMLCodec) ContentType() string {
+	return "application/xml"
+}
+
+func (XMLCodec) Encode(v any) ([]byte, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Map {
+		return nil, ErrUnsupportedValue
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buffer)
+	var err error
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		items := xml.StartElement{Name: xml.Name{Local: "items"}}
+		err = encoder.EncodeToken(items)
+		for i := 0; err == nil && i < value.Len(); i++ {
+			err = encoder.Encode(value.Index(i).Interface())
+		}
+		if err == nil {
+			err = encoder.EncodeToken(items.End())
+		}
+		if err == nil {
+			err = encoder.Flush()
+		}
+	} else {
+		err = encoder.Encode(v)
+	}
+	if err != nil {
+		if _, unsupported := err.(*xml.UnsupportedTypeError); unsupported {
+			return nil, ErrUnsupportedValue
+		}
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// CSVCodec encodes structs and slices of structs as CSV with a header row. The column names are
+// taken from the csv tag or the field name, fields tagged with csv:"-" are skipped.
+type CSVCodec struct{}
+
+func (CSVCodec) ContentType() string {
+	return "text/csv"
+}
+
+func (CSVCodec) Encode(v any) ([]byte, error) {
+	rows := reflect.ValueOf(v)
+	for rows.Kind() == reflect.Pointer {
+		rows = rows.Elem()
+	}
+	if rows.Kind() == reflect.Struct {
+		single := reflect.MakeSlice(reflect.SliceOf(rows.Type()), 1, 1)
+		single.Index(0).Set(rows)
+		rows = single
+	}
+	if rows.Kind() != reflect.Slice && rows.Kind() != reflect.Array {
+		return nil, ErrUnsupportedValue
+	}
+	elementType := rows.Type().Elem()
+	for elementType.Kind() == reflect.Pointer {
+		elementType = elementType.Elem()
+	}
+	if elementType.Kind() != reflect.Struct {
+		return nil, ErrUnsupportedValue
+	}
+	columns := csvColumns(elementType)
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		for row.Kind() == reflect.Pointer {
+			row = row.Elem()
+		}
+		record := make([]string, len(columns))
+		if row.IsValid() {
+			for j, column := range columns {
+				field, err := row.FieldByIndexErr(column.index)
+				if err == nil {
+					record[j] = csvValue(field)
+				}
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvColumns returns the exported fields of the struct including the fields of embedded structs.
+func csvColumns(structType reflect.Type) []csvColumn {
+	var columns []csvColumn
+	for _, field := range reflect.VisibleFields(structType) {
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("csv")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, csvColumn{name: name, index: field.Index})
+	}
+	return columns
+}
+
+// csvValue formats the value of a cell. Text marshalers like time.Time and decimals are used
+// with their text representation.
+func csvValue(value reflect.Value) string {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return ""
+		}
+		if marshaler, ok := value.Interface().(encoding.TextMarshaler); ok {
+			text, err := marshaler.MarshalText()
+			if err == nil {
+				return string(text)
+			}
+		}
+		value = value.Elem()
+	}
+	if value.CanInterface() {
+		switch typed := value.Interface().(type) {
+		case encoding.TextMarshaler:
+			if text, err := typed.MarshalText(); err == nil {
+				return string(text)
+			}
+		case fmt.Stringer:
+			return typed.String()
+		}
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type csvBase struct {
+	Symbol string `csv:"symbol"`
+}
+
+type csvRow struct {
+	csvBase
+	Price   decimal.Decimal `csv:"price"`
+	Time    time.Time       `csv:"time"`
+	Note    *string         `csv:"note"`
+	Label   csvLabel
+	Secret  string `csv:"-"`
+	private string
+}
+
+type csvLabel string
+
+func (l csvLabel) String() string {
+	return "label " + string(l)
+}
+
+func TestCSVCodec(t *testing.T) {
+	note := "a, \"quoted\" note"
+	rows := []*csvRow{
+		{
+			csvBase: csvBase{Symbol: "ACME"},
+			Price:   decimal.RequireFromString("1.50"),
+			Time:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			Note:    &note,
+			Label:   "a",
+			Secret:  "secret",
+			private: "private",
+		},
+		nil,
+		{csvBase: csvBase{Symbol: "EMCA"}, Price: decimal.Zero},
+	}
+	encoded, err := CSVCodec{}.Encode(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "symbol,price,time,note,Label\n" +
+		"ACME,1.5,2024-05-01T12:00:00Z,\"a, \"\"quoted\"\" note\",label a\n" +
+		",,,,\n" +
+		"EMCA,0,0001-01-01T00:00:00Z,,label \n"
+	if string(encoded) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, encoded)
+	}
+}
+
+func TestCSVCodecSingleStruct(t *testing.T) {
+	encoded, err := CSVCodec{}.Encode(&csvBase{Symbol: "ACME"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != "symbol\nACME\n" {
+		t.Errorf("unexpected encoding %q", encoded)
+	}
+}
+
+func TestCSVCodecUnsupported(t *testing.T) {
+	for _, value := range []any{map[string]int{"a": 1}, []int{1}, "text", nil} {
+		if _, err := (CSVCodec{}).Encode(value); !errors.Is(err, ErrUnsupportedValue) {
+			t.Errorf("%T: expected ErrUnsupportedValue, got %v", value, err)
+		}
+	}
+}
+
+func TestXMLCodec(t *testing.T) {
+	type item struct {
+		Symbol string `xml:"symbol"`
+	}
+	encoded, err := XMLCodec{}.Encode([]item{{Symbol: "A"}, {Symbol: "B"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(encoded), "<items><item><symbol>A</symbol></item><item><symbol>B</symbol></item></items>") {
+		t.Errorf("expected the slice wrapped in items, got %s", encoded)
+	}
+	for _, value := range []any{map[string]int{"a": 1}, make(chan int)} {
+		if _, err := (XMLCodec{}).Encode(value); !errors.Is(err, ErrUnsupportedValue) {
+			t.Errorf("%T: expected ErrUnsupportedValue, got %v", value, err)
+		}
+	}
+}
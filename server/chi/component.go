@@ -25,9 +25,11 @@ package chi
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/boot-go/boot"
@@ -37,17 +39,35 @@ import (
 type lifeState uint8
 
 // server provides the default implementation using the chi.server. Other components
-// can register context paths to process certain requests.
+// can register context paths to process certain requests. The request timeout is applied
+// to all routes except WebSocket upgrades and event streams.
 type server struct {
-	Eventbus   boot.EventBus `boot:"wire"`
-	Runtime    boot.Runtime  `boot:"wire"`
-	Port       int           `boot:"config,key:${HTTP_SERVER_PORT},default:8080"`
-	router     chi.Router
-	httpServer *http.Server
-	testServer *httptest.Server
+	Eventbus       boot.EventBus `boot:"wire"`
+	Runtime        boot.Runtime  `boot:"wire"`
+	Port           int           `boot:"config,key:${HTTP_SERVER_PORT},default:8080"`
+	RequestTimeout int           `boot:"config,key:${HTTP_SERVER_REQUEST_TIMEOUT},default:0"` // seconds, 0 disables
+	// unmatched requests
+	FallbackLogLevel string `boot:"config,key:${HTTP_SERVER_FALLBACK_LOG_LEVEL},default:warn"` // debug, info, warn, error or off
+	FallbackLogBody  int    `boot:"config,key:${HTTP_SERVER_FALLBACK_LOG_BODY},default:0"`     // bytes of the body, which are logged
+	FallbackProblem  bool   `boot:"config,key:${HTTP_SERVER_FALLBACK_PROBLEM},default:true"`   // problem+json instead of an empty 404
+	// api versions
+	VersionHeader  string `boot:"config,key:${HTTP_SERVER_VERSION_HEADER},default:API-Version"` // header selecting the version, empty disables
+	DefaultVersion string `boot:"config,key:${HTTP_SERVER_DEFAULT_VERSION},default:"`           // version of unversioned requests, defaults to the first version
+	notFound       http.HandlerFunc
+	router         chi.Router
+	routes         chi.Router
+	httpServer     *http.Server
+	testServer     *httptest.Server
+	hub            *Hub
+	streams        streams
+	broker         *Broker
+	readiness      readiness
+	registrations  *registrations
+	versions       *versions
 	// lifecycle
-	shutdown chan error
-	state    lifeState
+	shutdown   chan error
+	state      lifeState
+	stateMutex sync.RWMutex
 }
 
 const (
@@ -63,21 +83,66 @@ const (
 )
 
 func init() {
-	boot.Register(func() boot.Component {
-		return &server{}
-	})
+	boot.Register(NewComponent)
+}
+
+// NewComponent creates the server component. It is registered by default and only required
+// when a boot.Session is set up manually, e.g. in tests.
+func NewComponent() boot.Component {
+	return &server{}
 }
 
 var _ Server = (*server)(nil)
 
+func (s *server) setState(state lifeState) {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	s.state = state
+}
+
+func (s *server) currentState() lifeState {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.state
+}
+
+// stopping returns true if the server is shutting down or already shutted down.
+func (s *server) stopping() bool {
+	state := s.currentState()
+	return state == ServerShuttingDown || state == ServerShuttedDown
+}
+
 func (s *server) Init() error {
 	s.router = chi.NewRouter()
+	s.router.NotFound(s.unmatchedHandler)
+	s.versions = newVersions(s.VersionHeader, normalizeVersion(s.DefaultVersion))
+	s.shutdown = make(chan error, 1)
+	s.registrations = newRegistrations()
+	s.routes = &guardedRouter{Router: s.router, reg: s.registrations, server: s}
+	s.hub = newHub()
+	s.broker = newBroker(s)
+	err := s.Eventbus.Subscribe(func(e ShutDownInitiatedEvent) {
+		s.hub.CloseAll(CloseGoingAway, "server shutting down")
+		s.streams.closeAll()
+	})
+	if err != nil {
+		return err
+	}
+	err = s.Eventbus.Subscribe(func(e routerSealedEvent) {
+		s.registrations.seal()
+	})
+	if err != nil {
+		return err
+	}
 	if s.Runtime.HasFlag(boot.StandardFlag) {
 		s.initHttpServer()
 	} else if s.Runtime.HasFlag(boot.UnitTestFlag) {
 		s.initTestServer()
 	}
-	return nil
+	if s.RequestTimeout > 0 {
+		s.Use(Timeout(time.Duration(s.RequestTimeout)*time.Second, http.StatusServiceUnavailable))
+	}
+	return s.registrations.err()
 }
 
 func (s *server) initHttpServer() {
@@ -92,12 +157,12 @@ func (s *server) initHttpServer() {
 		}
 		return http.HandlerFunc(fn)
 	})
-	s.state = ServerReady
+	s.setState(ServerReady)
 }
 
 func (s *server) initTestServer() {
 	s.testServer = httptest.NewUnstartedServer(s.router)
-	s.state = ServerReady
+	s.setState(ServerReady)
 }
 
 func (s *server) Start() error {
@@ -118,19 +183,29 @@ func (s *server) Start() error {
 }
 
 func (s *server) startHttpServer() error {
-	s.router.HandleFunc("/", logRequestHandler)
-	err := s.Eventbus.Publish(InitializedEvent{})
+	err := s.initializeRouter()
+	if err != nil {
+		return err
+	}
+	err = s.Eventbus.Publish(InitializedEvent{})
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
 	if err != nil {
 		return err
 	}
 	boot.Logger.Info.Printf("http net listening on %s", s.httpServer.Addr)
-	s.shutdown = make(chan error)
-	s.state = ServerLive
+	s.setState(ServerLive)
 	s.httpServer.RegisterOnShutdown(func() {
 		err = s.Eventbus.Publish(ShutDownInitiatedEvent{})
 		boot.Logger.Error.Printf("failed to process shutdown initiated event: %v", err)
 	})
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	err = s.Eventbus.Publish(StartedEvent{URL: "http://" + listener.Addr().String()})
+	if err != nil {
+		return err
+	}
+	if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
 		boot.Logger.Error.Printf("http net closed unexpectedly: %v", err.Error())
 	}
 	s.httpServer.Close()
@@ -138,13 +213,17 @@ func (s *server) startHttpServer() error {
 }
 
 func (s *server) startTestServer() error {
-	err := s.Eventbus.Publish(InitializedEvent{})
+	err := s.initializeRouter()
+	if err != nil {
+		return err
+	}
+	err = s.Eventbus.Publish(InitializedEvent{})
 	if err != nil {
 		return err
 	}
-	s.state = ServerLive
 	s.testServer.Start()
-	return nil
+	s.setState(ServerLive)
+	return s.Eventbus.Publish(StartedEvent{URL: s.testServer.URL})
 }
 
 func (s *server) Stop() error {
@@ -154,13 +233,13 @@ func (s *server) Stop() error {
 			return err
 		}
 	} else if s.Runtime.HasFlag(boot.UnitTestFlag) {
-		s.stopTestServer()
+		return s.stopTestServer()
 	}
 	return nil
 }
 
 func (s *server) stopHttpServer() error {
-	s.state = ServerShuttingDown
+	s.setState(ServerShuttingDown)
 	if s.httpServer != nil {
 		boot.Logger.Info.Printf("shutting down net")
 		err := s.Eventbus.Publish(ShutDownInitiatedEvent{})
@@ -182,12 +261,28 @@ func (s *server) stopHttpServer() error {
 	} else {
 		boot.Logger.Warn.Printf("net is not in shutdown mode! shutdown first before stopping it...")
 	}
-	s.state = ServerShuttedDown
+	s.setState(ServerShuttedDown)
+	s.signalShutdown(nil)
 	return nil
 }
 
-func (s *server) stopTestServer() {
-	s.state = ServerShuttingDown
+func (s *server) stopTestServer() error {
+	s.setState(ServerShuttingDown)
+	// close open streams, otherwise closing the test server would block
+	err := s.Eventbus.Publish(ShutDownInitiatedEvent{})
+	if err != nil {
+		return err
+	}
 	s.testServer.Close()
-	s.state = ServerShuttedDown
+	s.setState(ServerShuttedDown)
+	s.signalShutdown(nil)
+	return s.Eventbus.Publish(ShutDownCompletedEvent{})
+}
+
+// signalShutdown releases the blocking Start, if it is still waiting.
+func (s *server) signalShutdown(err error) {
+	select {
+	case s.shutdown <- err:
+	default:
+	}
 }
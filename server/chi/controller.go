@@ -25,7 +25,9 @@ package chi
 
 import (
 	"context"
+	"io/fs"
 	"net/http"
+	"strings"
 
 	"github.com/boot-go/boot"
 	"github.com/go-chi/chi/v5"
@@ -55,6 +57,15 @@ type Server interface {
 	Group(fn func(r chi.Router)) chi.Router
 	// Mount
 	Mount(pattern string, handlerFunc http.Handler)
+	// API versions
+	Version(version string, fn func(r chi.Router)) chi.Router
+	DeprecateVersion(version string, deprecation Deprecation)
+	Versions() []APIVersion
+	// OpenAPI document
+	OpenAPI(info OpenAPIInfo) OpenAPI
+	OpenAPIHandler(info OpenAPIInfo) http.HandlerFunc
+	// Static files
+	Static(prefix string, fsys fs.FS, opts StaticOptions)
 	// Method
 	Method(method, pattern string, handler http.Handler)
 	MethodFunc(method, pattern string, handlerFunc http.HandlerFunc)
@@ -66,6 +77,16 @@ type Server interface {
 	Routes() []chi.Route
 	Middlewares() chi.Middlewares
 	Match(ctx *chi.Context, method, path string) bool
+	// WebSocket
+	Upgrade(w http.ResponseWriter, r *http.Request, opts WebSocketOptions) (*WebSocketConn, error)
+	Hub() *Hub
+	// Server-sent events
+	Stream(w http.ResponseWriter, r *http.Request, opts SSEOptions) (*SSEStream, error)
+	Broker() *Broker
+	// Readiness
+	AddReadinessCheck(name string, check ReadinessCheck)
+	Ready() error
+	ReadinessHandler() http.HandlerFunc
 	// Server control
 	Shutdown()
 }
@@ -89,113 +110,170 @@ func (s *server) With(middlewares ...func(http.Handler) http.Handler) chi.Router
 	for _, middleware := range middlewares {
 		boot.Logger.Debug.Printf("attaching middleware %s\n", boot.QualifiedName(middleware))
 	}
-	return s.router.With(middlewares...)
+	return s.routes.With(middlewares...)
 }
 
 func (s *server) Group(fn func(r chi.Router)) chi.Router {
 	boot.Logger.Debug.Printf("group - new inline router along current routing path with new middlerware")
-	return s.router.Group(fn)
+	return s.routes.Group(fn)
 }
 
 func (s *server) Mount(pattern string, handler http.Handler) {
 	boot.Logger.Debug.Printf("mount handler %s at %s", boot.QualifiedName(handler), pattern)
-	s.router.Mount(pattern, handler)
+	s.routes.Mount(pattern, handler)
+}
+
+func (s *server) Static(prefix string, fsys fs.FS, opts StaticOptions) {
+	boot.Logger.Debug.Printf("serving static files at %s", prefix)
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" {
+		s.routes.Handle(prefix, http.RedirectHandler(prefix+"/", http.StatusMovedPermanently))
+	}
+	s.routes.Handle(prefix+"/*", newStaticHandler(fsys, opts))
 }
 
 func (s *server) Method(method, pattern string, handler http.Handler) {
 	boot.Logger.Debug.Printf("method %s handler %s at %s", method, boot.QualifiedName(handler), pattern)
-	s.router.Method(method, pattern, handler)
+	s.routes.Method(method, pattern, handler)
 }
 
 func (s *server) MethodFunc(method, pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("method %s handlerFunc %s at %s", method, boot.QualifiedName(handlerFunc), pattern)
-	s.router.MethodFunc(method, pattern, handlerFunc)
+	s.routes.MethodFunc(method, pattern, handlerFunc)
 }
 
 func (s *server) MethodNotAllowed(handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("method not allowed handlerFunc %s", boot.QualifiedName(handlerFunc))
-	s.router.MethodNotAllowed(handlerFunc)
+	s.routes.MethodNotAllowed(handlerFunc)
 }
 
+// NotFound replaces the fallback handler for unmatched requests. Unmatched requests are still
+// counted in the metrics.
 func (s *server) NotFound(handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("not found handlerFunc %s", boot.QualifiedName(handlerFunc))
-	s.router.NotFound(handlerFunc)
+	s.routes.NotFound(handlerFunc)
 }
 
 func (s *server) Route(pattern string, fn func(r chi.Router)) chi.Router {
 	boot.Logger.Debug.Printf("attaching route %s at %s", boot.QualifiedName(fn), pattern)
-	return s.router.Route(pattern, fn)
+	return s.routes.Route(pattern, fn)
 }
 
 func (s *server) Use(middlewares ...func(http.Handler) http.Handler) {
 	for _, middleware := range middlewares {
 		boot.Logger.Debug.Printf("attaching middleware %s\n", boot.QualifiedName(middleware))
 	}
-	s.router.Use(middlewares...)
+	s.routes.Use(middlewares...)
 }
 
 func (s *server) Handle(pattern string, handler http.Handler) {
 	boot.Logger.Debug.Printf("attaching handler %s at %s", boot.QualifiedName(handler), pattern)
-	s.router.Handle(pattern, handler)
+	s.routes.Handle(pattern, handler)
 }
 
 func (s *server) HandleFunc(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching handler function %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.HandleFunc(pattern, handlerFunc)
+	s.routes.HandleFunc(pattern, handlerFunc)
 }
 
 // HTTP-method routing along `pattern`
 func (s *server) Connect(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Connect> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Connect(pattern, handlerFunc)
+	s.routes.Connect(pattern, handlerFunc)
 }
 
 func (s *server) Delete(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Delete> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Delete(pattern, handlerFunc)
+	s.routes.Delete(pattern, handlerFunc)
 }
 
 func (s *server) Get(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Get> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Get(pattern, handlerFunc)
+	s.routes.Get(pattern, handlerFunc)
 }
 
 func (s *server) Head(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Head> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Head(pattern, handlerFunc)
+	s.routes.Head(pattern, handlerFunc)
 }
 
 func (s *server) Options(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Options> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Options(pattern, handlerFunc)
+	s.routes.Options(pattern, handlerFunc)
 }
 
 func (s *server) Patch(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Patch> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Patch(pattern, handlerFunc)
+	s.routes.Patch(pattern, handlerFunc)
 }
 
 func (s *server) Post(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Post> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Post(pattern, handlerFunc)
+	s.routes.Post(pattern, handlerFunc)
 }
 
 func (s *server) Put(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Put> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Put(pattern, handlerFunc)
+	s.routes.Put(pattern, handlerFunc)
 }
 
 func (s *server) Trace(pattern string, handlerFunc http.HandlerFunc) {
 	boot.Logger.Debug.Printf("attaching <Trace> handler %s at %s", boot.QualifiedName(handlerFunc), pattern)
-	s.router.Trace(pattern, handlerFunc)
+	s.routes.Trace(pattern, handlerFunc)
+}
+
+// Upgrade upgrades the request to a WebSocket connection, which is tracked by the hub and closed
+// when the server shuts down.
+func (s *server) Upgrade(w http.ResponseWriter, r *http.Request, opts WebSocketOptions) (*WebSocketConn, error) {
+	if s.stopping() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return nil, ErrWebSocketUnavailable
+	}
+	conn, err := upgradeWebSocket(w, r, opts, s.hub)
+	if err != nil {
+		boot.Logger.Warn.Printf("websocket upgrade of %s failed: %v", r.URL.Path, err)
+		return nil, err
+	}
+	boot.Logger.Debug.Printf("websocket connection %s opened at %s", conn.ID(), r.URL.Path)
+	return conn, nil
+}
+
+// Hub returns the hub containing all open WebSocket connections.
+func (s *server) Hub() *Hub {
+	return s.hub
+}
+
+// Stream opens an event stream, which is closed when the server shuts down.
+func (s *server) Stream(w http.ResponseWriter, r *http.Request, opts SSEOptions) (*SSEStream, error) {
+	if s.stopping() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return nil, ErrSSEUnavailable
+	}
+	stream, err := openStream(w, r, opts)
+	if err != nil {
+		boot.Logger.Warn.Printf("event stream at %s failed: %v", r.URL.Path, err)
+		return nil, err
+	}
+	s.streams.add(stream)
+	return stream, nil
+}
+
+// Broker returns the publish/subscribe broker for server-sent events.
+func (s *server) Broker() *Broker {
+	return s.broker
 }
 
 // Shutdown gracefully shuts down the net
 func (s *server) Shutdown() {
 	go func() {
-		s.state = ServerShuttingDown
+		s.setState(ServerShuttingDown)
+		if s.testServer != nil {
+			s.testServer.Close()
+			s.signalShutdown(nil)
+			return
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
-		s.shutdown <- s.httpServer.Shutdown(ctx)
+		s.signalShutdown(s.httpServer.Shutdown(ctx))
 	}()
 }
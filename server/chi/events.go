@@ -23,14 +23,23 @@
 
 package chi
 
+import "github.com/go-chi/chi/v5"
+
 // InitializedEvent is emitted when the net will be started directly afterwards.
 type InitializedEvent struct{}
 
-// RouterInitializedEvent is emitted before the net is created. Use this
-// event to initialize the mux.
-// type RouterInitializedEvent struct {
-//	Router chi.Router
-// }
+// RouterInitializedEvent is emitted before the InitializedEvent and before the net accepts
+// connections. Use this event to register routes and middlewares. All handlers are processed
+// before the net is started, registrations afterwards are rejected with ErrRouterSealed.
+type RouterInitializedEvent struct {
+	Router chi.Router
+}
+
+// StartedEvent is emitted when the net accepts connections. In unit test mode the URL
+// refers to the test server.
+type StartedEvent struct {
+	URL string
+}
 
 // ShutDownInitiatedEvent is emitted when the net will be stopped directly afterwards.
 type ShutDownInitiatedEvent struct{}
@@ -24,21 +24,93 @@
 package chi
 
 import (
-	"github.com/boot-go/boot"
+	"expvar"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/boot-go/boot"
+)
+
+const (
+	// fallbackDrainLimit is the maximum amount of bytes read from unmatched requests, so the
+	// connection can be reused. Larger bodies close the connection instead.
+	fallbackDrainLimit = 64 << 10
+	redactedQueryValue = "REDACTED"
 )
 
-func logRequestHandler(rw http.ResponseWriter, req *http.Request) {
-	defer req.Body.Close()
+// metrics are published with expvar, e.g. at /debug/vars when the expvar handler is mounted.
+var metrics = expvar.NewMap("boot_stack_http_server")
 
-	body, err := io.ReadAll(req.Body)
-	if err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
-		boot.Logger.Error.Printf("unknown request received. url: %s - error: %s", req.URL, err)
+// fallbackLogger returns the logger of the configured level or nil, if logging is off.
+func fallbackLogger(level string) *log.Logger {
+	switch strings.ToLower(level) {
+	case "debug":
+		return boot.Logger.Debug
+	case "info":
+		return boot.Logger.Info
+	case "warn", "warning":
+		return boot.Logger.Warn
+	case "error":
+		return boot.Logger.Error
+	default:
+		return nil
+	}
+}
+
+// unmatchedHandler is the not found handler of the router. Requests without version prefix are
+// served by the requested or default version, if it has the route. It counts all other
+// unmatched requests and calls the custom not found handler, if one is set.
+func (s *server) unmatchedHandler(w http.ResponseWriter, r *http.Request) {
+	if s.serveVersion(w, r) {
+		return
+	}
+	metrics.Add("unmatched_requests", 1)
+	if s.notFound != nil {
+		s.notFound(w, r)
 		return
 	}
-	boot.Logger.Error.Printf("unknown request received. url: %s - body: %s", req.URL, string(body))
+	s.fallbackHandler(w, r)
+}
 
-	rw.WriteHeader(http.StatusNotFound)
+// fallbackHandler logs unmatched requests with a limited and redacted body and answers with
+// 404 Not Found.
+func (s *server) fallbackHandler(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Body != nil {
+		defer r.Body.Close()
+		if s.FallbackLogBody > 0 {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, int64(s.FallbackLogBody)))
+		}
+		// drain the remaining body, so the connection can be reused
+		if n, _ := io.CopyN(io.Discard, r.Body, fallbackDrainLimit); n == fallbackDrainLimit {
+			w.Header().Set("Connection", "close")
+		}
+	}
+	if logger := fallbackLogger(s.FallbackLogLevel); logger != nil {
+		if s.FallbackLogBody > 0 {
+			logger.Printf("unknown request received. method: %s url: %s - body: %q", r.Method, redactedURL(r.URL), body)
+		} else {
+			logger.Printf("unknown request received. method: %s url: %s", r.Method, redactedURL(r.URL))
+		}
+	}
+	if s.FallbackProblem {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "no route matches "+r.URL.Path))
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// redactedURL returns the path and the query keys without values, which may contain secrets.
+func redactedURL(u *url.URL) string {
+	query := u.Query()
+	if len(query) == 0 {
+		return u.EscapedPath()
+	}
+	for key := range query {
+		query[key] = []string{redactedQueryValue}
+	}
+	return u.EscapedPath() + "?" + query.Encode()
 }
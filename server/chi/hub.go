@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"sync"
+)
+
+// Hub tracks all WebSocket connections of the server. Connections can join rooms, so messages
+// can be sent to a subset of the connections.
+type Hub struct {
+	mutex sync.RWMutex
+	conns map[*WebSocketConn]map[string]struct{}
+	rooms map[string]map[*WebSocketConn]struct{}
+}
+
+func newHub() *Hub {
+	return &Hub{
+		conns: make(map[*WebSocketConn]map[string]struct{}),
+		rooms: make(map[string]map[*WebSocketConn]struct{}),
+	}
+}
+
+// Count returns the amount of open connections.
+func (h *Hub) Count() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.conns)
+}
+
+// Broadcast sends the message to all connections.
+func (h *Hub) Broadcast(messageType int, data []byte) {
+	for _, conn := range h.snapshot("", false) {
+		_ = conn.WriteMessage(messageType, data)
+	}
+}
+
+// BroadcastRoom sends the message to all connections, which joined the room.
+func (h *Hub) BroadcastRoom(room string, messageType int, data []byte) {
+	for _, conn := range h.snapshot(room, true) {
+		_ = conn.WriteMessage(messageType, data)
+	}
+}
+
+// CloseAll closes all connections with the given code and reason.
+func (h *Hub) CloseAll(code int, reason string) {
+	for _, conn := range h.snapshot("", false) {
+		conn.Close(code, reason)
+	}
+}
+
+func (h *Hub) snapshot(room string, inRoom bool) []*WebSocketConn {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var conns []*WebSocketConn
+	if inRoom {
+		for conn := range h.rooms[room] {
+			conns = append(conns, conn)
+		}
+	} else {
+		for conn := range h.conns {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+func (h *Hub) add(conn *WebSocketConn) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.conns[conn] = make(map[string]struct{})
+}
+
+func (h *Hub) remove(conn *WebSocketConn) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for room := range h.conns[conn] {
+		delete(h.rooms[room], conn)
+		if len(h.rooms[room]) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+	delete(h.conns, conn)
+}
+
+func (h *Hub) join(conn *WebSocketConn, room string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	rooms, ok := h.conns[conn]
+	if !ok {
+		return
+	}
+	rooms[room] = struct{}{}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*WebSocketConn]struct{})
+	}
+	h.rooms[room][conn] = struct{}{}
+}
+
+func (h *Hub) leave(conn *WebSocketConn, room string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.conns[conn], room)
+	delete(h.rooms[room], conn)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+}
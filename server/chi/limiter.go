@@ -0,0 +1,381 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/boot-go/boot"
+)
+
+// Priority of a route, which is used by the Limiter to decide which requests are shed first.
+type Priority int
+
+// priorities
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical
+)
+
+const (
+	defaultLimiterQueueTimeout  = 100 * time.Millisecond
+	defaultLimiterRetryAfter    = time.Second
+	defaultLimiterDegradedAfter = 10 * time.Second
+	limiterWindow               = time.Second
+)
+
+// ErrDegraded is reported by the Limiter readiness check under sustained load shedding.
+var ErrDegraded = errors.New("degraded by sustained load shedding")
+
+// LimitAlgorithm calculates the allowed amount of concurrent requests. Implementations are
+// called while the Limiter is locked and must not block.
+type LimitAlgorithm interface {
+	// Limit returns the current amount of allowed concurrent requests.
+	Limit() int
+	// Observe is called after each admitted request with its latency and the amount of
+	// requests in flight at the time it was admitted.
+	Observe(latency time.Duration, inflight int)
+}
+
+type fixedLimit int
+
+// FixedLimit allows a constant amount of concurrent requests.
+func FixedLimit(limit int) LimitAlgorithm {
+	return fixedLimit(limit)
+}
+
+func (l fixedLimit) Limit() int {
+	return int(l)
+}
+
+func (l fixedLimit) Observe(time.Duration, int) {}
+
+// aimdLimit increases the limit additively as long as the latency stays below the target and
+// decreases it multiplicatively otherwise.
+type aimdLimit struct {
+	limit   float64
+	min     float64
+	max     float64
+	target  time.Duration
+	backoff float64
+}
+
+// AIMDLimit creates an additive increase, multiplicative decrease algorithm. The limit grows
+// until the latency exceeds the target.
+func AIMDLimit(initial, min, max int, target time.Duration) LimitAlgorithm {
+	return &aimdLimit{
+		limit:   float64(initial),
+		min:     float64(min),
+		max:     float64(max),
+		target:  target,
+		backoff: 0.9,
+	}
+}
+
+func (l *aimdLimit) Limit() int {
+	return int(l.limit)
+}
+
+func (l *aimdLimit) Observe(latency time.Duration, inflight int) {
+	if latency > l.target {
+		l.limit = math.Max(l.min, l.limit*l.backoff)
+	} else if float64(inflight) >= l.limit/2 {
+		// only grow when the limit is actually used
+		l.limit = math.Min(l.max, l.limit+1/l.limit)
+	}
+}
+
+// gradientLimit adjusts the limit by the ratio of the lowest and the current latency, so
+// growing queues within the handlers reduce the limit before latency exceeds a fixed target.
+type gradientLimit struct {
+	limit      float64
+	min        float64
+	max        float64
+	minLatency time.Duration
+	smoothed   time.Duration
+	samples    int
+}
+
+const gradientResetSamples = 1000
+
+// GradientLimit creates a gradient based algorithm, which needs no latency target.
+func GradientLimit(initial, min, max int) LimitAlgorithm {
+	return &gradientLimit{
+		limit: float64(initial),
+		min:   float64(min),
+		max:   float64(max),
+	}
+}
+
+func (l *gradientLimit) Limit() int {
+	return int(l.limit)
+}
+
+func (l *gradientLimit) Observe(latency time.Duration, _ int) {
+	if latency <= 0 {
+		return
+	}
+	l.samples++
+	// the lowest latency is probed again from time to time, because it may change
+	if l.minLatency == 0 || latency < l.minLatency || l.samples%gradientResetSamples == 0 {
+		l.minLatency = latency
+	}
+	if l.smoothed == 0 {
+		l.smoothed = latency
+	} else {
+		l.smoothed = (l.smoothed*9 + latency) / 10
+	}
+	gradient := math.Max(0.5, math.Min(1.0, float64(l.minLatency)/float64(l.smoothed)))
+	queue := math.Sqrt(l.limit)
+	limit := l.limit*gradient + queue
+	// smooth the limit changes
+	l.limit = math.Max(l.min, math.Min(l.max, l.limit*0.8+limit*0.2))
+}
+
+// LimiterOptions configures the Limiter.
+type LimiterOptions struct {
+	// Algorithm defaults to a fixed limit of 100 concurrent requests.
+	Algorithm LimitAlgorithm
+	// MaxQueue is the amount of requests, which may wait for a free slot.
+	MaxQueue int
+	// QueueTimeout is the maximum time a request waits for a free slot. Defaults to 100ms.
+	QueueTimeout time.Duration
+	// RetryAfter is sent with shed requests. Defaults to one second.
+	RetryAfter time.Duration
+	// DegradedAfter defines how long shedding must last until the readiness check fails.
+	// Defaults to 10 seconds.
+	DegradedAfter time.Duration
+}
+
+// Limiter limits the amount of concurrent requests. Excess requests are queued by priority and
+// shed with 503 Service Unavailable, if no slot becomes available in time.
+type Limiter struct {
+	opts          LimiterOptions
+	mutex         sync.Mutex
+	inflight      int
+	queue         []*limiterWaiter
+	sequence      uint64
+	windowStart   time.Time
+	windowShed    int
+	sheddingSince time.Time
+}
+
+type limiterWaiter struct {
+	priority Priority
+	sequence uint64
+	inflight int // admitted inflight requests, set before ready is signaled
+	ready    chan bool
+}
+
+const defaultLimiterLimit = 100
+
+// NewLimiter creates a Limiter. Register Check as readiness check, so the server reports
+// degraded under sustained shedding.
+func NewLimiter(opts LimiterOptions) *Limiter {
+	if opts.Algorithm == nil {
+		opts.Algorithm = FixedLimit(defaultLimiterLimit)
+	}
+	if opts.QueueTimeout <= 0 {
+		opts.QueueTimeout = defaultLimiterQueueTimeout
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = defaultLimiterRetryAfter
+	}
+	if opts.DegradedAfter <= 0 {
+		opts.DegradedAfter = defaultLimiterDegradedAfter
+	}
+	return &Limiter{opts: opts}
+}
+
+// Handler returns the middleware for routes with the given priority. Requests with
+// PriorityCritical are never shed.
+func (l *Limiter) Handler(priority Priority) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			inflight, ok := l.acquire(priority)
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(l.opts.RetryAfter.Seconds()))))
+				WriteProblem(w, r, NewProblem(http.StatusServiceUnavailable, "server is overloaded"))
+				return
+			}
+			start := time.Now()
+			defer func() {
+				l.release(time.Since(start), inflight)
+			}()
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Inflight returns the amount of requests currently processed.
+func (l *Limiter) Inflight() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.inflight
+}
+
+// Limit returns the current limit of the algorithm.
+func (l *Limiter) Limit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.opts.Algorithm.Limit()
+}
+
+// Check returns ErrDegraded, if requests were shed continuously for the configured duration.
+func (l *Limiter) Check() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rollWindow(time.Now())
+	if !l.sheddingSince.IsZero() && time.Since(l.sheddingSince) >= l.opts.DegradedAfter {
+		return ErrDegraded
+	}
+	return nil
+}
+
+// acquire returns the amount of requests in flight including the admitted request.
+func (l *Limiter) acquire(priority Priority) (int, bool) {
+	l.mutex.Lock()
+	if l.inflight < l.opts.Algorithm.Limit() || priority == PriorityCritical {
+		l.inflight++
+		inflight := l.inflight
+		l.mutex.Unlock()
+		return inflight, true
+	}
+	waiter := l.enqueue(priority)
+	if waiter == nil {
+		l.shed()
+		l.mutex.Unlock()
+		return 0, false
+	}
+	l.mutex.Unlock()
+	timer := time.NewTimer(l.opts.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-waiter.ready:
+		if !ok {
+			return 0, false
+		}
+		return waiter.inflight, true
+	case <-timer.C:
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		if l.dequeue(waiter) {
+			l.shed()
+			return 0, false
+		}
+		// the slot was granted concurrently
+		if <-waiter.ready {
+			return waiter.inflight, true
+		}
+		return 0, false
+	}
+}
+
+// enqueue adds a waiter to the queue. If the queue is full, the waiter with the lowest
+// priority is shed, as long as it has a lower priority than the new one.
+func (l *Limiter) enqueue(priority Priority) *limiterWaiter {
+	if l.opts.MaxQueue <= 0 {
+		return nil
+	}
+	if len(l.queue) >= l.opts.MaxQueue {
+		lowest := l.queue[len(l.queue)-1]
+		if lowest.priority >= priority {
+			return nil
+		}
+		l.queue = l.queue[:len(l.queue)-1]
+		l.shed()
+		lowest.ready <- false
+	}
+	l.sequence++
+	waiter := &limiterWaiter{priority: priority, sequence: l.sequence, ready: make(chan bool, 1)}
+	l.queue = append(l.queue, waiter)
+	sort.SliceStable(l.queue, func(i, j int) bool {
+		if l.queue[i].priority != l.queue[j].priority {
+			return l.queue[i].priority > l.queue[j].priority
+		}
+		return l.queue[i].sequence < l.queue[j].sequence
+	})
+	return waiter
+}
+
+func (l *Limiter) dequeue(waiter *limiterWaiter) bool {
+	for i, candidate := range l.queue {
+		if candidate == waiter {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release frees the slot and hands it over to the next waiter.
+func (l *Limiter) release(latency time.Duration, inflight int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.opts.Algorithm.Observe(latency, inflight)
+	l.inflight--
+	for len(l.queue) > 0 && l.inflight < l.opts.Algorithm.Limit() {
+		waiter := l.queue[0]
+		l.queue = l.queue[1:]
+		l.inflight++
+		waiter.inflight = l.inflight
+		waiter.ready <- true
+	}
+	l.rollWindow(time.Now())
+}
+
+// shed must be called while locked.
+func (l *Limiter) shed() {
+	now := time.Now()
+	l.rollWindow(now)
+	l.windowShed++
+	if l.sheddingSince.IsZero() {
+		l.sheddingSince = now
+		boot.Logger.Warn.Printf("shedding load with %d requests in flight", l.inflight)
+	}
+}
+
+// rollWindow resets the shedding state, if a complete window passed without shedding.
+func (l *Limiter) rollWindow(now time.Time) {
+	if now.Sub(l.windowStart) < limiterWindow {
+		return
+	}
+	// a complete window without shedding passed
+	idle := l.windowShed == 0 || now.Sub(l.windowStart) >= 2*limiterWindow
+	if idle && !l.sheddingSince.IsZero() {
+		boot.Logger.Info.Printf("load shedding stopped after %s", now.Sub(l.sheddingSince))
+		l.sheddingSince = time.Time{}
+	}
+	l.windowStart = now
+	l.windowShed = 0
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFixedLimit(t *testing.T) {
+	limit := FixedLimit(3)
+	limit.Observe(time.Hour, 3)
+	if limit.Limit() != 3 {
+		t.Errorf("expected a constant limit of 3, got %d", limit.Limit())
+	}
+}
+
+func TestAIMDLimit(t *testing.T) {
+	limit := AIMDLimit(10, 5, 12, 100*time.Millisecond)
+	limit.Observe(10*time.Millisecond, 1)
+	if limit.Limit() != 10 {
+		t.Errorf("expected no increase of an unused limit, got %d", limit.Limit())
+	}
+	for i := 0; i < 100; i++ {
+		limit.Observe(10*time.Millisecond, 10)
+	}
+	if limit.Limit() != 12 {
+		t.Errorf("expected the limit to grow up to the maximum, got %d", limit.Limit())
+	}
+	limit.Observe(200*time.Millisecond, 12)
+	if limit.Limit() != 10 {
+		t.Errorf("expected a multiplicative decrease to 10, got %d", limit.Limit())
+	}
+	for i := 0; i < 100; i++ {
+		limit.Observe(200*time.Millisecond, 10)
+	}
+	if limit.Limit() != 5 {
+		t.Errorf("expected the limit to shrink down to the minimum, got %d", limit.Limit())
+	}
+}
+
+func TestGradientLimit(t *testing.T) {
+	limit := GradientLimit(20, 5, 50)
+	limit.Observe(0, 1)
+	if limit.Limit() != 20 {
+		t.Errorf("expected invalid latencies to be ignored, got %d", limit.Limit())
+	}
+	for i := 0; i < 100; i++ {
+		limit.Observe(10*time.Millisecond, 20)
+	}
+	if limit.Limit() != 50 {
+		t.Errorf("expected a stable latency to grow the limit up to the maximum, got %d", limit.Limit())
+	}
+	previous := limit.Limit()
+	for i := 0; i < 10; i++ {
+		limit.Observe(100*time.Millisecond, 20)
+		if limit.Limit() > previous {
+			t.Fatalf("expected a rising latency to not increase the limit, got %d after %d", limit.Limit(), previous)
+		}
+		previous = limit.Limit()
+	}
+	if previous >= 50 {
+		t.Errorf("expected a rising latency to decrease the limit, got %d", previous)
+	}
+	for i := 0; i < 100; i++ {
+		limit.Observe(100*time.Millisecond, 20)
+	}
+	if limit.Limit() < 5 {
+		t.Errorf("expected the limit to stay above the minimum, got %d", limit.Limit())
+	}
+}
+
+func TestLimiterDefaults(t *testing.T) {
+	limiter := NewLimiter(LimiterOptions{})
+	if limiter.Limit() != defaultLimiterLimit || limiter.opts.QueueTimeout != defaultLimiterQueueTimeout ||
+		limiter.opts.RetryAfter != defaultLimiterRetryAfter || limiter.opts.DegradedAfter != defaultLimiterDegradedAfter {
+		t.Errorf("unexpected defaults %+v", limiter.opts)
+	}
+}
+
+func TestLimiterPriorityQueue(t *testing.T) {
+	limiter := NewLimiter(LimiterOptions{Algorithm: FixedLimit(1), MaxQueue: 4})
+	if _, ok := limiter.acquire(PriorityNormal); !ok {
+		t.Fatal("expected the first request to be admitted")
+	}
+	limiter.mutex.Lock()
+	low := limiter.enqueue(PriorityLow)
+	normal := limiter.enqueue(PriorityNormal)
+	high := limiter.enqueue(PriorityHigh)
+	secondHigh := limiter.enqueue(PriorityHigh)
+	limiter.mutex.Unlock()
+	for i, expected := range []*limiterWaiter{high, secondHigh, normal, low} {
+		limiter.release(time.Millisecond, 1)
+		select {
+		case ok := <-expected.ready:
+			if !ok || expected.inflight != 1 {
+				t.Fatalf("expected waiter %d to be admitted with one request in flight", i)
+			}
+		default:
+			t.Fatalf("expected waiter %d of priority %d to be admitted next", i, expected.priority)
+		}
+	}
+	limiter.release(time.Millisecond, 1)
+	if limiter.Inflight() != 0 {
+		t.Errorf("expected no requests in flight, got %d", limiter.Inflight())
+	}
+}
+
+func TestLimiterShedsLowestPriority(t *testing.T) {
+	limiter := NewLimiter(LimiterOptions{Algorithm: FixedLimit(1), MaxQueue: 2})
+	limiter.acquire(PriorityNormal)
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	low := limiter.enqueue(PriorityLow)
+	normal := limiter.enqueue(PriorityNormal)
+	if limiter.enqueue(PriorityLow) != nil {
+		t.Error("expected a full queue to shed requests without higher priority")
+	}
+	if limiter.enqueue(PriorityHigh) == nil {
+		t.Fatal("expected a request with higher priority to be queued")
+	}
+	select {
+	case ok := <-low.ready:
+		if ok {
+			t.Error("expected the waiter with the lowest priority to be shed")
+		}
+	default:
+		t.Error("expected the waiter with the lowest priority to be signaled")
+	}
+	if len(normal.ready) != 0 || len(limiter.queue) != 2 {
+		t.Errorf("expected the remaining waiters to stay queued, got %d", len(limiter.queue))
+	}
+	if limiter.sheddingSince.IsZero() {
+		t.Error("expected the shedding to be recorded")
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	limiter := NewLimiter(LimiterOptions{Algorithm: FixedLimit(1), MaxQueue: 1, QueueTimeout: time.Millisecond})
+	limiter.acquire(PriorityNormal)
+	if _, ok := limiter.acquire(PriorityHigh); ok {
+		t.Error("expected the request to be shed after the queue timeout")
+	}
+	if len(limiter.queue) != 0 {
+		t.Errorf("expected the timed out waiter to be removed, got %d", len(limiter.queue))
+	}
+}
+
+func TestLimiterCriticalIsNeverShed(t *testing.T) {
+	limiter := NewLimiter(LimiterOptions{Algorithm: FixedLimit(1)})
+	limiter.acquire(PriorityHigh)
+	if _, ok := limiter.acquire(PriorityHigh); ok {
+		t.Error("expected requests above the limit to be shed without queue")
+	}
+	for i := 0; i < 3; i++ {
+		if _, ok := limiter.acquire(PriorityCritical); !ok {
+			t.Fatal("expected critical requests to be admitted above the limit")
+		}
+	}
+	if limiter.Inflight() != 4 {
+		t.Errorf("expected 4 requests in flight, got %d", limiter.Inflight())
+	}
+}
+
+func TestLimiterHandlerRetryAfter(t *testing.T) {
+	limiter := NewLimiter(LimiterOptions{Algorithm: FixedLimit(0), RetryAfter: 1500 * time.Millisecond})
+	handler := limiter.Handler(PriorityNormal)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected 503 with Retry-After 2, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	w = httptest.NewRecorder()
+	limiter.Handler(PriorityCritical)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNoContent || limiter.Inflight() != 0 {
+		t.Errorf("expected the critical request to be served and released, got %d", w.Code)
+	}
+}
+
+func TestLimiterCheck(t *testing.T) {
+	limiter := NewLimiter(LimiterOptions{Algorithm: FixedLimit(0), DegradedAfter: time.Minute})
+	if err := limiter.Check(); err != nil {
+		t.Fatalf("expected a ready limiter, got %v", err)
+	}
+	limiter.acquire(PriorityNormal)
+	if err := limiter.Check(); err != nil {
+		t.Errorf("expected short shedding to keep the limiter ready, got %v", err)
+	}
+	limiter.mutex.Lock()
+	limiter.sheddingSince = time.Now().Add(-time.Minute)
+	limiter.mutex.Unlock()
+	if err := limiter.Check(); !errors.Is(err, ErrDegraded) {
+		t.Errorf("expected ErrDegraded, got %v", err)
+	}
+	limiter.mutex.Lock()
+	limiter.windowStart = time.Now().Add(-2 * limiterWindow)
+	limiter.mutex.Unlock()
+	if err := limiter.Check(); err != nil {
+		t.Errorf("expected a window without shedding to recover, got %v", err)
+	}
+}
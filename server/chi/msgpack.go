@@ -0,0 +1,356 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MessagePackCodec encodes values as MessagePack. Structs are encoded as maps with the names of
+// the msgpack or json tag, time.Time uses the timestamp extension type, JSON marshalers are
+// encoded as their JSON value and other text marshalers as strings. The alias replaces the content type, e.g. for the legacy
+// application/x-msgpack.
+type MessagePackCodec struct {
+	Alias string
+}
+
+func (c MessagePackCodec) ContentType() string {
+	if c.Alias != "" {
+		return c.Alias
+	}
+	return "application/msgpack"
+}
+
+func (MessagePackCodec) Encode(v any) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := encodeMessagePack(&buffer, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonNumberType    = reflect.TypeOf(json.Number(""))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func encodeMessagePack(buffer *bytes.Buffer, value reflect.Value) error {
+	for value.IsValid() && (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			buffer.WriteByte(0xc0)
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		buffer.WriteByte(0xc0)
+		return nil
+	}
+	if value.Type() == timeType {
+		writeMessagePackTime(buffer, value.Interface().(time.Time))
+		return nil
+	}
+	if marshaler, ok := messagePackMarshaler(value, jsonMarshalerType); ok {
+		return encodeMessagePackJSON(buffer, marshaler.(json.Marshaler))
+	}
+	if marshaler, ok := messagePackMarshaler(value, textMarshalerType); ok {
+		text, err := marshaler.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeMessagePackString(buffer, string(text))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeMessagePackInt(buffer, value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeMessagePackUint(buffer, value.Uint())
+	case reflect.Float32:
+		buffer.WriteByte(0xca)
+		_ = binary.Write(buffer, binary.BigEndian, math.Float32bits(float32(value.Float())))
+	case reflect.Float64:
+		buffer.WriteByte(0xcb)
+		_ = binary.Write(buffer, binary.BigEndian, math.Float64bits(value.Float()))
+	case reflect.String:
+		if value.Type() == jsonNumberType {
+			writeMessagePackNumber(buffer, json.Number(value.String()))
+			return nil
+		}
+		writeMessagePackString(buffer, value.String())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			buffer.WriteByte(0xc0)
+			return nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(bytes), value)
+			writeMessagePackBinary(buffer, bytes)
+			return nil
+		}
+		writeMessagePackHeader(buffer, value.Len(), 0x90, 0xdc, 0xdd, 15)
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeMessagePack(buffer, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.IsNil() {
+			buffer.WriteByte(0xc0)
+			return nil
+		}
+		keys := value.MapKeys()
+		// sorted keys keep the encoding stable, e.g. for caching and snapshots
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		writeMessagePackHeader(buffer, len(keys), 0x80, 0xde, 0xdf, 15)
+		for _, key := range keys {
+			if err := encodeMessagePack(buffer, key); err != nil {
+				return err
+			}
+			if err := encodeMessagePack(buffer, value.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return encodeMessagePackStruct(buffer, value)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedValue, value.Type())
+	}
+	return nil
+}
+
+// messagePackMarshaler returns the value as marshaler of the interface type. Like encoding/json,
+// methods with pointer receiver are only used for addressable values.
+func messagePackMarshaler(value reflect.Value, marshalerType reflect.Type) (any, bool) {
+	if value.Type().Implements(marshalerType) {
+		return value.Interface(), true
+	}
+	if value.CanAddr() && reflect.PointerTo(value.Type()).Implements(marshalerType) {
+		return value.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// encodeMessagePackJSON encodes the JSON value of the marshaler, e.g. decimals as string. JSON
+// numbers are encoded as integer, if they are integral, otherwise as float.
+func encodeMessagePackJSON(buffer *bytes.Buffer, marshaler json.Marshaler) error {
+	data, err := marshaler.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return err
+	}
+	return encodeMessagePack(buffer, reflect.ValueOf(v))
+}
+
+// encodeMessagePackStruct encodes the exported fields as map. Fields with omitempty are skipped,
+// when they contain the zero value.
+func encodeMessagePackStruct(buffer *bytes.Buffer, value reflect.Value) error {
+	type field struct {
+		name  string
+		value reflect.Value
+	}
+	var fields []field
+	for _, structField := range reflect.VisibleFields(value.Type()) {
+		if !structField.IsExported() {
+			continue
+		}
+		tag, ok := structField.Tag.Lookup("msgpack")
+		if !ok {
+			tag = structField.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		if structField.Anonymous && tag == "" && structField.Type.Kind() == reflect.Struct {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		name := options[0]
+		if name == "" {
+			name = structField.Name
+		}
+		fieldValue, err := value.FieldByIndexErr(structField.Index)
+		if err != nil {
+			continue
+		}
+		omitEmpty := false
+		for _, option := range options[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+		if omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+		fields = append(fields, field{name: name, value: fieldValue})
+	}
+	writeMessagePackHeader(buffer, len(fields), 0x80, 0xde, 0xdf, 15)
+	for _, f := range fields {
+		writeMessagePackString(buffer, f.name)
+		if err := encodeMessagePack(buffer, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMessagePackHeader writes the header of arrays and maps, which share the same layout with
+// a fix, 16 and 32 bit variant.
+func writeMessagePackHeader(buffer *bytes.Buffer, length int, fix, code16, code32 byte, maxFix int) {
+	switch {
+	case length <= maxFix:
+		buffer.WriteByte(fix | byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(code16)
+		_ = binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(code32)
+		_ = binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+}
+
+func writeMessagePackString(buffer *bytes.Buffer, s string) {
+	length := len(s)
+	switch {
+	case length <= 31:
+		buffer.WriteByte(0xa0 | byte(length))
+	case length <= math.MaxUint8:
+		buffer.WriteByte(0xd9)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(0xda)
+		_ = binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(0xdb)
+		_ = binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+	buffer.WriteString(s)
+}
+
+func writeMessagePackBinary(buffer *bytes.Buffer, b []byte) {
+	length := len(b)
+	switch {
+	case length <= math.MaxUint8:
+		buffer.WriteByte(0xc4)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(0xc5)
+		_ = binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(0xc6)
+		_ = binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+	buffer.Write(b)
+}
+
+func writeMessagePackInt(buffer *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0:
+		writeMessagePackUint(buffer, uint64(i))
+	case i >= -32:
+		buffer.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8:
+		buffer.WriteByte(0xd0)
+		buffer.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16:
+		buffer.WriteByte(0xd1)
+		_ = binary.Write(buffer, binary.BigEndian, int16(i))
+	case i >= math.MinInt32:
+		buffer.WriteByte(0xd2)
+		_ = binary.Write(buffer, binary.BigEndian, int32(i))
+	default:
+		buffer.WriteByte(0xd3)
+		_ = binary.Write(buffer, binary.BigEndian, i)
+	}
+}
+
+func writeMessagePackUint(buffer *bytes.Buffer, u uint64) {
+	switch {
+	case u <= 0x7f:
+		buffer.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		buffer.WriteByte(0xcc)
+		buffer.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		buffer.WriteByte(0xcd)
+		_ = binary.Write(buffer, binary.BigEndian, uint16(u))
+	case u <= math.MaxUint32:
+		buffer.WriteByte(0xce)
+		_ = binary.Write(buffer, binary.BigEndian, uint32(u))
+	default:
+		buffer.WriteByte(0xcf)
+		_ = binary.Write(buffer, binary.BigEndian, u)
+	}
+}
+
+func writeMessagePackNumber(buffer *bytes.Buffer, number json.Number) {
+	if i, err := number.Int64(); err == nil {
+		writeMessagePackInt(buffer, i)
+		return
+	}
+	f, _ := number.Float64()
+	buffer.WriteByte(0xcb)
+	_ = binary.Write(buffer, binary.BigEndian, math.Float64bits(f))
+}
+
+// writeMessagePackTime writes the timestamp extension type -1 in the 32, 64 or 96 bit format.
+func writeMessagePackTime(buffer *bytes.Buffer, t time.Time) {
+	seconds := t.Unix()
+	nanos := uint64(t.Nanosecond())
+	switch {
+	case seconds >= 0 && seconds>>32 == 0 && nanos == 0:
+		buffer.Write([]byte{0xd6, 0xff})
+		_ = binary.Write(buffer, binary.BigEndian, uint32(seconds))
+	case seconds >= 0 && seconds>>34 == 0:
+		buffer.Write([]byte{0xd7, 0xff})
+		_ = binary.Write(buffer, binary.BigEndian, nanos<<34|uint64(seconds))
+	default:
+		buffer.Write([]byte{0xc7, 12, 0xff})
+		_ = binary.Write(buffer, binary.BigEndian, uint32(nanos))
+		_ = binary.Write(buffer, binary.BigEndian, seconds)
+	}
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMessagePackFormats(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"nil", nil, "c0"},
+		{"false", false, "c2"},
+		{"true", true, "c3"},
+		{"positive fixint", 127, "7f"},
+		{"uint8", 128, "cc80"},
+		{"uint16", 256, "cd0100"},
+		{"uint32", 65536, "ce00010000"},
+		{"uint64", uint64(1) << 32, "cf0000000100000000"},
+		{"negative fixint", -32, "e0"},
+		{"int8", -33, "d0df"},
+		{"int16", -129, "d1ff7f"},
+		{"int32", -32769, "d2ffff7fff"},
+		{"int64", int64(math.MinInt32) - 1, "d3ffffffff7fffffff"},
+		{"float32", float32(1.5), "ca3fc00000"},
+		{"float64", 1.5, "cb3ff8000000000000"},
+		{"fixstr", "abc", "a3616263"},
+		{"str8", strings.Repeat("a", 32), "d920" + strings.Repeat("61", 32)},
+		{"bin8", []byte{1, 2}, "c4020102"},
+		{"fixarray", []int{1, 2}, "920102"},
+		{"array16", make([]bool, 16), "dc0010" + strings.Repeat("c2", 16)},
+		{"nil slice", []int(nil), "c0"},
+		{"fixmap sorted", map[string]int{"b": 2, "a": 1}, "82a16101a16202"},
+		{"timestamp32", time.Unix(1, 0), "d6ff00000001"},
+		{"timestamp64", time.Unix(1, 1), "d7ff0000000400000001"},
+		{"timestamp96", time.Unix(-1, 0), "c70cff00000000ffffffffffffffff"},
+		{"text marshaler", textValue("x"), "a3783a78"},
+		{"json marshaler", jsonValue{}, "82a16101a162c0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := MessagePackCodec{}.Encode(test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(encoded); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMessagePackRoundTrip(t *testing.T) {
+	type money struct {
+		Amount   decimal.Decimal `json:"amount"`
+		Currency string          `json:"currency"`
+	}
+	type quote struct {
+		Symbol  string          `json:"symbol"`
+		Price   money           `json:"price"`
+		Change  decimal.Decimal `json:"change"`
+		Volume  int64           `msgpack:"vol" json:"volume"`
+		Time    time.Time       `json:"time"`
+		Tags    []string        `json:"tags,omitempty"`
+		Ignored string          `json:"-"`
+	}
+	value := quote{
+		Symbol:  "ACME",
+		Price:   money{Amount: decimal.RequireFromString("123.45"), Currency: "USD"},
+		Change:  decimal.RequireFromString("-0.5"),
+		Volume:  -70000,
+		Time:    time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC),
+		Ignored: "ignored",
+	}
+	encoded, err := MessagePackCodec{}.Encode(&value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, rest, err := decodeMessagePack(encoded)
+	if err != nil || len(rest) > 0 {
+		t.Fatalf("invalid encoding %x: %v", encoded, err)
+	}
+	want := map[string]any{
+		"symbol": "ACME",
+		"price":  map[string]any{"amount": "123.45", "currency": "USD"},
+		"change": "-0.5",
+		"vol":    int64(-70000),
+		"time":   value.Time,
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("expected %v, got %v", want, decoded)
+	}
+}
+
+func TestMessagePackMarshalerPointerReceiver(t *testing.T) {
+	type wrapper struct {
+		Value pointerText `json:"value"`
+	}
+	encoded, err := MessagePackCodec{}.Encode(&wrapper{Value: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := decodeMessagePack(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"value": "text:x"}; !reflect.DeepEqual(decoded, want) {
+		t.Errorf("expected %v, got %v", want, decoded)
+	}
+}
+
+func TestMessagePackJSONNumbers(t *testing.T) {
+	decimal.MarshalJSONWithoutQuotes = true
+	defer func() { decimal.MarshalJSONWithoutQuotes = false }()
+	for input, want := range map[string]any{"42": int64(42), "-1.25": -1.25} {
+		encoded, err := MessagePackCodec{}.Encode(decimal.RequireFromString(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, _, err := decodeMessagePack(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != want {
+			t.Errorf("%s: expected %v, got %v", input, want, decoded)
+		}
+	}
+}
+
+func TestMessagePackUnsupported(t *testing.T) {
+	if _, err := (MessagePackCodec{}).Encode(make(chan int)); err == nil {
+		t.Error("expected an error for a channel")
+	}
+}
+
+type textValue string
+
+func (v textValue) MarshalText() ([]byte, error) {
+	return []byte(string(v) + ":" + string(v)), nil
+}
+
+type jsonValue struct{}
+
+func (jsonValue) MarshalJSON() ([]byte, error) {
+	return []byte(`{"b": null, "a": 1}`), nil
+}
+
+type pointerText string
+
+func (v *pointerText) MarshalText() ([]byte, error) {
+	return []byte("text:" + string(*v)), nil
+}
+
+// decodeMessagePack decodes the formats written by the codec. Integers are returned as int64,
+// maps as map[string]any and timestamps as time.Time in UTC.
+func decodeMessagePack(data []byte) (any, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end of data")
+	}
+	code, data := data[0], data[1:]
+	take := func(n int) ([]byte, error) {
+		if len(data) < n {
+			return nil, fmt.Errorf("unexpected end of data")
+		}
+		taken := data[:n]
+		data = data[n:]
+		return taken, nil
+	}
+	length := func(size int) (int, error) {
+		b, err := take(size)
+		if err != nil {
+			return 0, err
+		}
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return int(n), nil
+	}
+	collection := func(n int, isMap bool) (any, []byte, error) {
+		if isMap {
+			m := make(map[string]any, n)
+			for i := 0; i < n; i++ {
+				key, rest, err := decodeMessagePack(data)
+				if err != nil {
+					return nil, nil, err
+				}
+				value, rest, err := decodeMessagePack(rest)
+				if err != nil {
+					return nil, nil, err
+				}
+				m[fmt.Sprint(key)], data = value, rest
+			}
+			return m, data, nil
+		}
+		a := make([]any, n)
+		for i := range a {
+			value, rest, err := decodeMessagePack(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			a[i], data = value, rest
+		}
+		return a, data, nil
+	}
+	var n int
+	var err error
+	switch {
+	case code <= 0x7f:
+		return int64(code), data, nil
+	case code >= 0xe0:
+		return int64(int8(code)), data, nil
+	case code&0xf0 == 0x80:
+		return collection(int(code&0x0f), true)
+	case code&0xf0 == 0x90:
+		return collection(int(code&0x0f), false)
+	case code&0xe0 == 0xa0:
+		b, err := take(int(code & 0x1f))
+		return string(b), data, err
+	}
+	switch code {
+	case 0xc0:
+		return nil, data, nil
+	case 0xc2, 0xc3:
+		return code == 0xc3, data, nil
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb:
+		size := map[byte]int{0xc4: 1, 0xc5: 2, 0xc6: 4, 0xd9: 1, 0xda: 2, 0xdb: 4}[code]
+		if n, err = length(size); err != nil {
+			return nil, nil, err
+		}
+		b, err := take(n)
+		if code >= 0xd9 {
+			return string(b), data, err
+		}
+		return append([]byte(nil), b...), data, err
+	case 0xca:
+		b, err := take(4)
+		if err != nil {
+			return nil, nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), data, nil
+	case 0xcb:
+		b, err := take(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), data, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		size := 1 << (code - 0xcc)
+		if n, err = length(size); err != nil {
+			return nil, nil, err
+		}
+		return int64(n), data, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		u, err := length(size)
+		if err != nil {
+			return nil, nil, err
+		}
+		shift := 64 - 8*size
+		return int64(u) << shift >> shift, data, nil
+	case 0xdc, 0xdd, 0xde, 0xdf:
+		size := map[byte]int{0xdc: 2, 0xdd: 4, 0xde: 2, 0xdf: 4}[code]
+		if n, err = length(size); err != nil {
+			return nil, nil, err
+		}
+		return collection(n, code >= 0xde)
+	case 0xd6, 0xd7, 0xc7:
+		if code == 0xc7 {
+			if _, err = take(1); err != nil {
+				return nil, nil, err
+			}
+		}
+		if b, err := take(1); err != nil || b[0] != 0xff {
+			return nil, nil, fmt.Errorf("unexpected extension type")
+		}
+		switch code {
+		case 0xd6:
+			b, err := take(4)
+			if err != nil {
+				return nil, nil, err
+			}
+			return time.Unix(int64(binary.BigEndian.Uint32(b)), 0).UTC(), data, nil
+		case 0xd7:
+			b, err := take(8)
+			if err != nil {
+				return nil, nil, err
+			}
+			v := binary.BigEndian.Uint64(b)
+			return time.Unix(int64(v&(1<<34-1)), int64(v>>34)).UTC(), data, nil
+		default:
+			b, err := take(12)
+			if err != nil {
+				return nil, nil, err
+			}
+			return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b))).UTC(), data, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unsupported code %#x", code)
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/boot-go/boot"
+	"github.com/go-chi/chi/v5"
+)
+
+// OpenAPI is an OpenAPI 3.1 document describing the registered routes. It lists the paths,
+// methods and path parameters, request and response schemas aren't known to the router.
+type OpenAPI struct {
+	OpenAPI string                                 `json:"openapi"`
+	Info    OpenAPIInfo                            `json:"info"`
+	Tags    []OpenAPITag                           `json:"tags,omitempty"`
+	Paths   map[string]map[string]OpenAPIOperation `json:"paths"`
+}
+
+// OpenAPIInfo is the info object of the document.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPITag describes an API version, the operations of a version are tagged with it.
+type OpenAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIOperation is an operation of a path. Operations of deprecated versions are deprecated.
+type OpenAPIOperation struct {
+	Tags       []string                   `json:"tags,omitempty"`
+	Deprecated bool                       `json:"deprecated,omitempty"`
+	Parameters []OpenAPIParameter         `json:"parameters,omitempty"`
+	Responses  map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter is a path parameter. The regular expression of the route is the pattern.
+type OpenAPIParameter struct {
+	Name     string        `json:"name"`
+	In       string        `json:"in"`
+	Required bool          `json:"required"`
+	Schema   OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema is the schema of a path parameter.
+type OpenAPISchema struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// OpenAPIResponse is a response of an operation. Only the default response is described.
+type OpenAPIResponse struct {
+	Description string `json:"description"`
+}
+
+// openAPIMethods are the methods of routes registered for all methods. CONNECT isn't supported by
+// OpenAPI.
+var openAPIMethods = []string{"get", "head", "post", "put", "patch", "delete", "options", "trace"}
+
+// OpenAPI returns the document of the registered routes. The operations of versioned routes are
+// tagged with their version.
+func (s *server) OpenAPI(info OpenAPIInfo) OpenAPI {
+	document := OpenAPI{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Paths:   make(map[string]map[string]OpenAPIOperation),
+	}
+	versions := s.Versions()
+	deprecated := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		tag := OpenAPITag{Name: version.Name}
+		switch {
+		case version.Deprecation != nil:
+			tag.Description = "deprecated"
+			deprecated[version.Name] = true
+		case version.Default:
+			tag.Description = "default"
+		}
+		document.Tags = append(document.Tags, tag)
+	}
+	_ = chi.Walk(s.router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		path, parameters := openAPIPath(route)
+		operation := OpenAPIOperation{
+			Parameters: parameters,
+			Responses:  map[string]OpenAPIResponse{"default": {Description: "response of the handler"}},
+		}
+		if segment := strings.SplitN(strings.TrimPrefix(route, "/"), "/", 2)[0]; s.versions.known(segment) {
+			operation.Tags = []string{segment}
+			operation.Deprecated = deprecated[segment]
+		}
+		methods := []string{strings.ToLower(method)}
+		if method == "*" {
+			methods = openAPIMethods
+		}
+		for _, method := range methods {
+			if method == "connect" {
+				continue
+			}
+			if document.Paths[path] == nil {
+				document.Paths[path] = make(map[string]OpenAPIOperation)
+			}
+			document.Paths[path][method] = operation
+		}
+		return nil
+	})
+	return document
+}
+
+// openAPIPath converts the chi pattern to an OpenAPI path. Regular expressions become patterns
+// of the parameters and a trailing wildcard becomes the parameter path.
+func openAPIPath(route string) (string, []OpenAPIParameter) {
+	var parameters []OpenAPIParameter
+	var sb strings.Builder
+	for i := 0; i < len(route); i++ {
+		end := -1
+		if route[i] == '{' {
+			end = closingBrace(route, i)
+		}
+		if end < 0 {
+			sb.WriteByte(route[i])
+			continue
+		}
+		// parameters are {name} or {name:regexp}, the regexp may contain braces itself
+		name, pattern, _ := strings.Cut(route[i+1:end], ":")
+		parameter := OpenAPIParameter{Name: name, In: "path", Required: true, Schema: OpenAPISchema{Type: "string"}}
+		if pattern != "" {
+			parameter.Schema.Pattern = "^" + pattern + "$"
+		}
+		parameters = append(parameters, parameter)
+		sb.WriteString("{" + name + "}")
+		i = end
+	}
+	path := sb.String()
+	if strings.HasSuffix(path, "/*") {
+		path = strings.TrimSuffix(path, "*") + "{path}"
+		parameters = append(parameters, OpenAPIParameter{Name: "path", In: "path", Required: true, Schema: OpenAPISchema{Type: "string"}})
+	}
+	return path, parameters
+}
+
+// closingBrace returns the index of the brace closing the one at start or -1.
+func closingBrace(route string, start int) int {
+	depth := 0
+	for i := start; i < len(route); i++ {
+		switch route[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// OpenAPIHandler serves the document of the registered routes as JSON.
+func (s *server) OpenAPIHandler(info OpenAPIInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := json.Marshal(s.OpenAPI(info))
+		if err != nil {
+			boot.Logger.Error.Printf("failed to marshal openapi document: %v", err)
+			WriteProblem(w, r, NewProblem(http.StatusInternalServerError, "failed to create openapi document"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	server "github.com/boot-go/stack/server/chi"
+	"github.com/boot-go/stack/server/chi/servertest"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOpenAPI(t *testing.T) {
+	var s server.Server
+	servertest.Start(t, &routes{register: func(srv server.Server) {
+		s = srv
+		noop := func(http.ResponseWriter, *http.Request) {}
+		srv.Get("/codes/{code:[0-9]{3}}", noop)
+		srv.Get("/quotes/{symbol}/bars/{interval:[a-z]+}", noop)
+		srv.Handle("/static/*", http.HandlerFunc(noop))
+		srv.Version("v1", func(r chi.Router) {
+			r.Post("/orders", noop)
+		})
+		srv.DeprecateVersion("v1", server.Deprecation{})
+	}})
+	document := s.OpenAPI(server.OpenAPIInfo{Title: "test", Version: "1.0"})
+
+	codes, ok := document.Paths["/codes/{code}"]["get"]
+	if !ok {
+		t.Fatalf("expected the path /codes/{code}, got %v", document.Paths)
+	}
+	expected := []server.OpenAPIParameter{{Name: "code", In: "path", Required: true, Schema: server.OpenAPISchema{Type: "string", Pattern: "^[0-9]{3}$"}}}
+	if !reflect.DeepEqual(codes.Parameters, expected) {
+		t.Errorf("expected parameters %v, got %v", expected, codes.Parameters)
+	}
+	if bars := document.Paths["/quotes/{symbol}/bars/{interval}"]["get"]; len(bars.Parameters) != 2 || bars.Parameters[1].Schema.Pattern != "^[a-z]+$" {
+		t.Errorf("unexpected parameters %v", bars.Parameters)
+	}
+	if static := document.Paths["/static/{path}"]; len(static) != 8 {
+		t.Errorf("expected all methods except connect for a handler, got %d", len(static))
+	}
+	orders := document.Paths["/v1/orders"]["post"]
+	if !orders.Deprecated || len(orders.Tags) != 1 || orders.Tags[0] != "v1" {
+		t.Errorf("expected a deprecated v1 operation, got %+v", orders)
+	}
+}
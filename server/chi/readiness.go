@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// ErrNotLive is reported by the readiness when the server isn't serving requests.
+var ErrNotLive = errors.New("server is not live")
+
+// ReadinessCheck returns an error, if the checked resource isn't able to serve requests.
+type ReadinessCheck func() error
+
+// readiness contains all named readiness checks.
+type readiness struct {
+	mutex  sync.RWMutex
+	checks map[string]ReadinessCheck
+}
+
+func (rd *readiness) add(name string, check ReadinessCheck) {
+	rd.mutex.Lock()
+	defer rd.mutex.Unlock()
+	if rd.checks == nil {
+		rd.checks = make(map[string]ReadinessCheck)
+	}
+	rd.checks[name] = check
+}
+
+// run executes all checks and returns the failed checks by name.
+func (rd *readiness) run() map[string]error {
+	rd.mutex.RLock()
+	defer rd.mutex.RUnlock()
+	failed := make(map[string]error)
+	for name, check := range rd.checks {
+		if err := check(); err != nil {
+			failed[name] = err
+		}
+	}
+	return failed
+}
+
+// readinessReport is returned by the readiness handler.
+type readinessReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (s *server) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.readiness.add(name, check)
+}
+
+// Ready returns nil, if the server is live and all readiness checks pass.
+func (s *server) Ready() error {
+	if s.currentState() != ServerLive {
+		return ErrNotLive
+	}
+	failed := s.readiness.run()
+	if len(failed) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(failed))
+	for name := range failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]error, 0, len(names))
+	for _, name := range names {
+		errs = append(errs, errors.New(name+": "+failed[name].Error()))
+	}
+	return errors.Join(errs...)
+}
+
+// ReadinessHandler answers with 200 OK if the server is ready, otherwise with
+// 503 Service Unavailable. The failed checks are part of the response.
+func (s *server) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := readinessReport{Status: "ready"}
+		status := http.StatusOK
+		if s.currentState() != ServerLive {
+			report.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		} else if failed := s.readiness.run(); len(failed) > 0 {
+			report.Status = "degraded"
+			report.Checks = make(map[string]string, len(failed))
+			for name, err := range failed {
+				report.Checks[name] = err.Error()
+			}
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
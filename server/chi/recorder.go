@@ -0,0 +1,450 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/boot-go/boot"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	defaultRecorderCapacity = 100
+	defaultRecorderBodySize = 64 << 10
+	redactedValue           = "[REDACTED]"
+)
+
+// default headers, which are always redacted
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// RecorderOptions configures which requests are recorded and how.
+type RecorderOptions struct {
+	// Capacity is the size of the ring buffer. Defaults to 100 entries.
+	Capacity int
+	// SampleRate between 0 and 1 defines the fraction of recorded requests. Defaults to 1.
+	SampleRate float64
+	// Filter returns true for requests, which should be recorded. All requests are recorded
+	// by default.
+	Filter func(r *http.Request) bool
+	// MaxBodySize limits the recorded request and response bodies. Defaults to 64KB.
+	MaxBodySize int
+	// RedactHeaders are recorded with a redacted value in addition to the authorization and
+	// cookie headers.
+	RedactHeaders []string
+	// RedactQuery are query parameters, which are recorded with a redacted value.
+	RedactQuery []string
+	// RedactBody may rewrite recorded bodies, e.g. to remove personal data.
+	RedactBody func(contentType string, body []byte) []byte
+}
+
+// Recorder records request/response pairs into a ring buffer, which can be downloaded as HAR.
+type Recorder struct {
+	opts          RecorderOptions
+	redactHeaders map[string]struct{}
+	redactQuery   map[string]struct{}
+	mutex         sync.Mutex
+	entries       []HAREntry
+	next          int
+	full          bool
+}
+
+// NewRecorder creates a Recorder. Use Handler as middleware and mount AdminHandler to download
+// the recordings.
+func NewRecorder(opts RecorderOptions) *Recorder {
+	if opts.Capacity <= 0 {
+		opts.Capacity = defaultRecorderCapacity
+	}
+	if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+		opts.SampleRate = 1
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultRecorderBodySize
+	}
+	rec := &Recorder{
+		opts:          opts,
+		redactHeaders: make(map[string]struct{}),
+		redactQuery:   make(map[string]struct{}),
+		entries:       make([]HAREntry, opts.Capacity),
+	}
+	for _, header := range append(defaultRedactHeaders, opts.RedactHeaders...) {
+		rec.redactHeaders[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	for _, param := range opts.RedactQuery {
+		rec.redactQuery[param] = struct{}{}
+	}
+	return rec
+}
+
+// Handler is the middleware recording the sampled and filtered requests.
+func (rec *Recorder) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if (rec.opts.Filter != nil && !rec.opts.Filter(r)) ||
+			(rec.opts.SampleRate < 1 && rand.Float64() >= rec.opts.SampleRate) { //nolint:gosec // sampling only
+			next.ServeHTTP(w, r)
+			return
+		}
+		started := time.Now()
+		requestBody := &limitedBuffer{limit: rec.opts.MaxBodySize}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, requestBody), Closer: r.Body}
+		}
+		responseBody := &limitedBuffer{limit: rec.opts.MaxBodySize}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(responseBody)
+		defer func() {
+			rec.add(rec.entry(r, ww, started, requestBody, responseBody))
+		}()
+		next.ServeHTTP(ww, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Entries returns the recorded entries from oldest to newest.
+func (rec *Recorder) Entries() []HAREntry {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	if !rec.full {
+		return append([]HAREntry(nil), rec.entries[:rec.next]...)
+	}
+	return append(append([]HAREntry(nil), rec.entries[rec.next:]...), rec.entries[:rec.next]...)
+}
+
+// HAR returns the recorded entries as HTTP archive.
+func (rec *Recorder) HAR() *HAR {
+	return NewHAR(rec.Entries())
+}
+
+// Clear removes all recorded entries.
+func (rec *Recorder) Clear() {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.entries = make([]HAREntry, rec.opts.Capacity)
+	rec.next = 0
+	rec.full = false
+}
+
+// AdminHandler downloads the recordings as HAR file on GET and clears them on DELETE. The
+// handler must be protected, because the recordings may contain sensitive data.
+func (rec *Recorder) AdminHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", `attachment; filename="recordings.har"`)
+			w.Header().Set("Cache-Control", "no-store")
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(rec.HAR()); err != nil {
+				boot.Logger.Error.Printf("failed to write recordings: %v", err)
+			}
+		case http.MethodDelete:
+			rec.Clear()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			WriteProblem(w, r, NewProblem(http.StatusMethodNotAllowed, ""))
+		}
+	}
+}
+
+func (rec *Recorder) add(entry HAREntry) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.entries[rec.next] = entry
+	rec.next = (rec.next + 1) % len(rec.entries)
+	if rec.next == 0 {
+		rec.full = true
+	}
+}
+
+func (rec *Recorder) entry(r *http.Request, ww middleware.WrapResponseWriter, started time.Time, requestBody, responseBody *limitedBuffer) HAREntry {
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	u := *r.URL
+	query := u.Query()
+	queryString := make([]HARNameValue, 0, len(query))
+	for name, values := range query {
+		if _, ok := rec.redactQuery[name]; ok {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+		for _, value := range values {
+			queryString = append(queryString, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(queryString, func(i, j int) bool {
+		return queryString[i].Name < queryString[j].Name
+	})
+	u.RawQuery = query.Encode()
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+	request := HARRequest{
+		Method:      r.Method,
+		URL:         u.String(),
+		HTTPVersion: r.Proto,
+		Headers:     rec.headers(r.Header),
+		QueryString: queryString,
+		HeadersSize: -1,
+		BodySize:    requestBody.total,
+	}
+	if requestBody.total > 0 {
+		contentType := r.Header.Get("Content-Type")
+		text, encoding := rec.body(contentType, requestBody)
+		request.PostData = &HARPostData{
+			MimeType:  contentType,
+			Text:      text,
+			Encoding:  encoding,
+			Truncated: requestBody.truncated(),
+			Comment:   requestBody.comment(),
+		}
+	}
+	contentType := ww.Header().Get("Content-Type")
+	text, encoding := rec.body(contentType, responseBody)
+	return HAREntry{
+		StartedDateTime: started,
+		Time:            float64(time.Since(started).Microseconds()) / 1000,
+		Request:         request,
+		Response: HARResponse{
+			Status:      status,
+			StatusText:  http.StatusText(status),
+			HTTPVersion: r.Proto,
+			Headers:     rec.headers(ww.Header()),
+			Content: HARContent{
+				Size:      responseBody.total,
+				MimeType:  contentType,
+				Text:      text,
+				Encoding:  encoding,
+				Truncated: responseBody.truncated(),
+				Comment:   responseBody.comment(),
+			},
+			RedirectURL: ww.Header().Get("Location"),
+			HeadersSize: -1,
+			BodySize:    ww.BytesWritten(),
+		},
+	}
+}
+
+func (rec *Recorder) headers(header http.Header) []HARNameValue {
+	headers := make([]HARNameValue, 0, len(header))
+	for name, values := range header {
+		_, redact := rec.redactHeaders[http.CanonicalHeaderKey(name)]
+		for _, value := range values {
+			if redact {
+				value = redactedValue
+			}
+			headers = append(headers, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Name < headers[j].Name
+	})
+	return headers
+}
+
+// body returns the redacted body as text, binary bodies are base64 encoded.
+func (rec *Recorder) body(contentType string, buffer *limitedBuffer) (string, string) {
+	body := buffer.Bytes()
+	if rec.opts.RedactBody != nil {
+		body = rec.opts.RedactBody(contentType, body)
+	}
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// limitedBuffer keeps the first bytes up to the limit and counts all written bytes.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+	total int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if remaining := b.limit - b.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.Buffer.Write(p[:remaining])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// truncated returns true if not all written bytes are kept.
+func (b *limitedBuffer) truncated() bool {
+	return b.total > b.Len()
+}
+
+// comment describes the truncation of the body for HAR viewers.
+func (b *limitedBuffer) comment() string {
+	if !b.truncated() {
+		return ""
+	}
+	return "truncated to " + strconv.Itoa(b.Len()) + " of " + strconv.Itoa(b.total) + " bytes"
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// HAR is an HTTP archive as defined by the HAR 1.2 specification.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog contains the recorded entries.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator describes the application, which created the archive.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request/response pair.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest is the recorded request.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is the recorded response.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is used for headers, query parameters and cookies.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the recorded request body. HAR 1.2 doesn't define an encoding of request
+// bodies, so binary bodies are marked with the custom field _encoding.
+type HARPostData struct {
+	MimeType  string `json:"mimeType"`
+	Text      string `json:"text"`
+	Encoding  string `json:"_encoding,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// HARContent is the recorded response body. Bodies exceeding the MaxBodySize of the recorder
+// are marked as truncated.
+type HARContent struct {
+	Size      int    `json:"size"`
+	MimeType  string `json:"mimeType"`
+	Text      string `json:"text,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// HARTimings aren't measured in detail, so only the wait time is set.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NewHAR creates an archive containing the entries.
+func NewHAR(entries []HAREntry) *HAR {
+	for i := range entries {
+		entries[i].Timings.Wait = entries[i].Time
+		if entries[i].Request.Cookies == nil {
+			entries[i].Request.Cookies = []HARNameValue{}
+		}
+		if entries[i].Response.Cookies == nil {
+			entries[i].Response.Cookies = []HARNameValue{}
+		}
+	}
+	return &HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "boot-stack", Version: "1.0"},
+			Entries: entries,
+		},
+	}
+}
+
+// ReadHAR decodes an HTTP archive.
+func ReadHAR(r io.Reader) (*HAR, error) {
+	har := &HAR{}
+	if err := json.NewDecoder(r).Decode(har); err != nil {
+		return nil, err
+	}
+	return har, nil
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/boot-go/boot"
+)
+
+// ErrUnsupportedValue is returned by a codec, which can't encode the value, e.g. CSV for a map.
+// Render continues with the next acceptable codec.
+var ErrUnsupportedValue = errors.New("value is not supported by codec")
+
+// Codec encodes values for a content type.
+type Codec interface {
+	ContentType() string
+	Encode(v any) ([]byte, error)
+}
+
+// codecRegistry contains the codecs in the order of registration. The first codec is used
+// when the client accepts any content type.
+type codecRegistry struct {
+	mutex  sync.RWMutex
+	codecs []Codec
+}
+
+var codecs = &codecRegistry{}
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(XMLCodec{})
+	RegisterCodec(CSVCodec{})
+	RegisterCodec(MessagePackCodec{})
+	RegisterCodec(MessagePackCodec{Alias: "application/x-msgpack"})
+}
+
+// RegisterCodec adds the codec to the registry. A codec for an already registered content type
+// replaces the existing one.
+func RegisterCodec(codec Codec) {
+	codecs.mutex.Lock()
+	defer codecs.mutex.Unlock()
+	contentType := strings.ToLower(codec.ContentType())
+	for i, registered := range codecs.codecs {
+		if strings.ToLower(registered.ContentType()) == contentType {
+			codecs.codecs[i] = codec
+			return
+		}
+	}
+	codecs.codecs = append(codecs.codecs, codec)
+}
+
+// acceptedRange is a media range of the Accept header with its quality.
+type acceptedRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges sorted by quality and specificity.
+func parseAccept(header string) []acceptedRange {
+	var ranges []acceptedRange
+	for _, value := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		ranges = append(ranges, acceptedRange{mediaType: mediaType, quality: quality})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].quality != ranges[j].quality {
+			return ranges[i].quality > ranges[j].quality
+		}
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+	return ranges
+}
+
+func (mr acceptedRange) matches(contentType string) bool {
+	switch {
+	case mr.mediaType == "*/*":
+		return true
+	case strings.HasSuffix(mr.mediaType, "/*"):
+		return strings.HasPrefix(contentType, strings.TrimSuffix(mr.mediaType, "*"))
+	default:
+		return mr.mediaType == contentType
+	}
+}
+
+// negotiate returns the acceptable codecs in the order of preference.
+func (reg *codecRegistry) negotiate(accept string) []Codec {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+	if strings.TrimSpace(accept) == "" {
+		return append([]Codec(nil), reg.codecs...)
+	}
+	var result []Codec
+	seen := make(map[int]bool)
+	for _, mediaRange := range parseAccept(accept) {
+		for i, codec := range reg.codecs {
+			if !seen[i] && mediaRange.matches(strings.ToLower(codec.ContentType())) {
+				seen[i] = true
+				result = append(result, codec)
+			}
+		}
+	}
+	return result
+}
+
+// Render encodes the value with the codec negotiated on the Accept header and writes it with
+// the status. Requests without acceptable codec are answered with 406 Not Acceptable.
+func Render(w http.ResponseWriter, r *http.Request, status int, v any) {
+	addVary(w.Header(), "Accept")
+	var body []byte
+	var codec Codec
+	for _, candidate := range codecs.negotiate(r.Header.Get("Accept")) {
+		encoded, err := candidate.Encode(v)
+		if errors.Is(err, ErrUnsupportedValue) {
+			continue
+		}
+		if err != nil {
+			boot.Logger.Error.Printf("failed to encode response as %s: %v", candidate.ContentType(), err)
+			WriteProblem(w, r, NewProblem(http.StatusInternalServerError, "failed to encode response"))
+			return
+		}
+		body, codec = encoded, candidate
+		break
+	}
+	if codec == nil {
+		WriteProblem(w, r, NewProblem(http.StatusNotAcceptable, "no acceptable representation available"))
+		return
+	}
+	contentType := codec.ContentType()
+	if strings.HasPrefix(contentType, "text/") {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = bytes.NewReader(body).WriteTo(w)
+	}
+}
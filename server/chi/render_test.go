@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	ranges := parseAccept("text/*;q=0.5, */*;q=0.1, application/json, invalid;;, application/xml;q=0, text/csv;q=0.5")
+	want := []acceptedRange{
+		{mediaType: "application/json", quality: 1},
+		{mediaType: "text/csv", quality: 0.5},
+		{mediaType: "text/*", quality: 0.5},
+		{mediaType: "*/*", quality: 0.1},
+	}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("expected %v, got %v", want, ranges)
+	}
+}
+
+func TestRenderNegotiation(t *testing.T) {
+	type row struct {
+		Symbol string `json:"symbol" xml:"symbol" csv:"symbol"`
+	}
+	tests := []struct {
+		name        string
+		accept      string
+		value       any
+		status      int
+		contentType string
+	}{
+		{"no accept header", "", row{"A"}, http.StatusOK, "application/json"},
+		{"any", "*/*", row{"A"}, http.StatusOK, "application/json"},
+		{"exact", "application/xml", row{"A"}, http.StatusOK, "application/xml"},
+		{"quality", "application/json;q=0.5, application/msgpack", row{"A"}, http.StatusOK, "application/msgpack"},
+		{"alias", "application/x-msgpack", row{"A"}, http.StatusOK, "application/x-msgpack"},
+		{"wildcard subtype", "text/*", []row{{"A"}}, http.StatusOK, "text/csv; charset=utf-8"},
+		{"case insensitive", "Application/JSON", row{"A"}, http.StatusOK, "application/json"},
+		{"unsupported value falls back", "text/csv, application/json;q=0.1", map[string]int{"a": 1}, http.StatusOK, "application/json"},
+		{"unsupported value", "text/csv", map[string]int{"a": 1}, http.StatusNotAcceptable, "application/problem+json"},
+		{"excluded", "application/json;q=0", row{"A"}, http.StatusNotAcceptable, "application/problem+json"},
+		{"unknown", "image/png", row{"A"}, http.StatusNotAcceptable, "application/problem+json"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.accept != "" {
+				r.Header.Set("Accept", test.accept)
+			}
+			w := httptest.NewRecorder()
+			Render(w, r, http.StatusOK, test.value)
+			if w.Code != test.status {
+				t.Errorf("expected %d, got %d", test.status, w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != test.contentType {
+				t.Errorf("expected content type %s, got %s", test.contentType, got)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("expected Vary: Accept, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRenderHead(t *testing.T) {
+	w := httptest.NewRecorder()
+	Render(w, httptest.NewRequest(http.MethodHead, "/", nil), http.StatusOK, map[string]int{"a": 1})
+	if w.Header().Get("Content-Length") != "7" || w.Body.Len() != 0 {
+		t.Errorf("expected the length of the body without the body, got %s %q", w.Header().Get("Content-Length"), w.Body.String())
+	}
+}
@@ -0,0 +1,430 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boot-go/boot"
+)
+
+// CachedResponse is a response stored by the ResponseCache. Responses with a Vary header are
+// stored per variant. The key without the variant refers to them with a response of status 0,
+// which only contains the Vary header.
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Created time.Time
+	Expires time.Time
+}
+
+// size returns the approximated memory usage of the response.
+func (c *CachedResponse) size() int {
+	size := len(c.Body)
+	for key, values := range c.Header {
+		size += len(key)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return size
+}
+
+// ResponseStore is the backend of the ResponseCache. Implementations must be safe for
+// concurrent use.
+type ResponseStore interface {
+	// Get returns the response stored under the key.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores the response under the key.
+	Set(key string, response *CachedResponse)
+	// DeleteFunc removes all responses with a matching key and returns the amount of removed responses.
+	DeleteFunc(match func(key string) bool) int
+}
+
+// lruStore is the default in-memory ResponseStore, which evicts the least recently used
+// responses when either the entry or the byte limit is exceeded.
+type lruStore struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	entries    *list.List
+	index      map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	response *CachedResponse
+	size     int
+}
+
+var _ ResponseStore = (*lruStore)(nil)
+
+// NewLRUStore creates an in-memory ResponseStore. A limit of zero or less disables the limit.
+func NewLRUStore(maxEntries, maxBytes int) ResponseStore {
+	return &lruStore{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    list.New(),
+		index:      make(map[string]*list.Element),
+	}
+}
+
+func (s *lruStore) Get(key string) (*CachedResponse, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	element, ok := s.index[key]
+	if !ok {
+		return nil, false
+	}
+	s.entries.MoveToFront(element)
+	return element.Value.(*lruEntry).response, true
+}
+
+func (s *lruStore) Set(key string, response *CachedResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entry := &lruEntry{key: key, response: response, size: response.size()}
+	if s.maxBytes > 0 && entry.size > s.maxBytes {
+		return
+	}
+	if element, ok := s.index[key]; ok {
+		s.bytes -= element.Value.(*lruEntry).size
+		element.Value = entry
+		s.entries.MoveToFront(element)
+	} else {
+		s.index[key] = s.entries.PushFront(entry)
+	}
+	s.bytes += entry.size
+	for (s.maxEntries > 0 && s.entries.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		s.remove(s.entries.Back())
+	}
+}
+
+func (s *lruStore) DeleteFunc(match func(key string) bool) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	count := 0
+	for element := s.entries.Front(); element != nil; {
+		next := element.Next()
+		if match(element.Value.(*lruEntry).key) {
+			s.remove(element)
+			count++
+		}
+		element = next
+	}
+	return count
+}
+
+func (s *lruStore) remove(element *list.Element) {
+	entry := s.entries.Remove(element).(*lruEntry)
+	delete(s.index, entry.key)
+	s.bytes -= entry.size
+}
+
+// ResponseCacheOptions configures the ResponseCache.
+type ResponseCacheOptions struct {
+	// TTL defines how long a response is fresh. Defaults to one minute.
+	TTL time.Duration
+	// StaleWhileRevalidate defines how long an expired response is still served, while it is
+	// refreshed in the background.
+	StaleWhileRevalidate time.Duration
+	// VaryHeaders are request headers, which are part of the cache key.
+	VaryHeaders []string
+	// Store is the cache backend. Defaults to an in-memory LRU store using MaxEntries and MaxBytes.
+	Store      ResponseStore
+	MaxEntries int
+	MaxBytes   int
+}
+
+// ResponseCache serves GET and HEAD responses from a ResponseStore without calling the handler.
+// Use Handler as middleware on the routes, which should be cached. It is a shared cache, so
+// responses setting cookies are never stored and requests with credentials only use responses,
+// which are explicitly public or have s-maxage, see RFC 9111 section 3.5. Cookies are no
+// credentials, when Cookie is one of the vary headers. The Vary header of the response adds the
+// listed request headers to the key, responses varying on * aren't stored. WebSocket upgrades
+// and event streams are passed through.
+type ResponseCache struct {
+	ttl         time.Duration
+	stale       time.Duration
+	varyHeaders []string
+	store       ResponseStore
+	mutex       sync.Mutex
+	refreshing  map[string]struct{}
+}
+
+const (
+	defaultResponseCacheTTL        = time.Minute
+	defaultResponseCacheMaxEntries = 1000
+)
+
+// NewResponseCache creates a ResponseCache with the given options.
+func NewResponseCache(opts ResponseCacheOptions) *ResponseCache {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultResponseCacheTTL
+	}
+	if opts.Store == nil {
+		if opts.MaxEntries == 0 && opts.MaxBytes == 0 {
+			opts.MaxEntries = defaultResponseCacheMaxEntries
+		}
+		opts.Store = NewLRUStore(opts.MaxEntries, opts.MaxBytes)
+	}
+	varyHeaders := make([]string, len(opts.VaryHeaders))
+	for i, header := range opts.VaryHeaders {
+		varyHeaders[i] = http.CanonicalHeaderKey(header)
+	}
+	sort.Strings(varyHeaders)
+	return &ResponseCache{
+		ttl:         opts.TTL,
+		stale:       opts.StaleWhileRevalidate,
+		varyHeaders: varyHeaders,
+		store:       opts.Store,
+		refreshing:  make(map[string]struct{}),
+	}
+}
+
+// Handler is the middleware, which serves cached responses.
+func (c *ResponseCache) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || streamingRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		primary := c.key(r)
+		key := primary
+		credentials := c.hasCredentials(r)
+		cached, ok := c.store.Get(primary)
+		if ok && cached.Status == 0 {
+			key = primary + variantKey(r, responseVary(cached.Header))
+			cached, ok = c.store.Get(key)
+		}
+		if ok && !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") &&
+			(!credentials || sharedExplicitly(cached.Header)) {
+			now := time.Now()
+			switch {
+			case now.Before(cached.Expires):
+				c.write(w, r, cached, "HIT")
+				return
+			case now.Before(cached.Expires.Add(c.stale)):
+				c.revalidate(primary, key, next, r, credentials)
+				c.write(w, r, cached, "STALE")
+				return
+			}
+		}
+		cached = c.fetch(primary, next, r, credentials)
+		c.write(w, r, cached, "MISS")
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Purge removes all cached responses.
+func (c *ResponseCache) Purge() int {
+	return c.store.DeleteFunc(func(string) bool {
+		return true
+	})
+}
+
+// PurgePath removes all cached responses of the given path regardless of the method, query or
+// vary headers.
+func (c *ResponseCache) PurgePath(path string) int {
+	return c.store.DeleteFunc(func(key string) bool {
+		_, rest, _ := strings.Cut(key, " ")
+		keyPath, _, _ := strings.Cut(rest, "?")
+		keyPath, _, _ = strings.Cut(keyPath, "\n")
+		return keyPath == path
+	})
+}
+
+// key uses the method, path, sorted query and the configured vary headers.
+func (c *ResponseCache) key(r *http.Request) string {
+	var sb strings.Builder
+	sb.WriteString(r.Method)
+	sb.WriteByte(' ')
+	sb.WriteString(r.URL.Path)
+	if query := r.URL.Query(); len(query) > 0 {
+		sb.WriteByte('?')
+		sb.WriteString(query.Encode())
+	}
+	for _, header := range c.varyHeaders {
+		sb.WriteByte('\n')
+		sb.WriteString(header)
+		sb.WriteByte(':')
+		sb.WriteString(strings.Join(r.Header.Values(header), ","))
+	}
+	return sb.String()
+}
+
+// variantKey is appended to the key of responses, which vary on the request headers.
+func variantKey(r *http.Request, headers []string) string {
+	var sb strings.Builder
+	sb.WriteString("\nvary")
+	for _, header := range headers {
+		sb.WriteByte('\n')
+		sb.WriteString(header)
+		sb.WriteByte(':')
+		sb.WriteString(strings.Join(r.Header.Values(header), ","))
+	}
+	return sb.String()
+}
+
+// responseVary returns the sorted and canonical header names of the Vary header.
+func responseVary(header http.Header) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hasCredentials returns true for requests with Authorization header or with cookies, which
+// aren't part of the key.
+func (c *ResponseCache) hasCredentials(r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	if r.Header.Get("Cookie") == "" {
+		return false
+	}
+	i := sort.SearchStrings(c.varyHeaders, "Cookie")
+	return i == len(c.varyHeaders) || c.varyHeaders[i] != "Cookie"
+}
+
+// fetch calls the handler and stores the response, if it is cacheable. Responses to requests
+// with credentials must be shared explicitly. Responses with a Vary header are stored under the
+// key of the variant and a marker under the primary key.
+func (c *ResponseCache) fetch(primary string, next http.Handler, r *http.Request, credentials bool) *CachedResponse {
+	bw := newBufferedWriter()
+	next.ServeHTTP(bw, r)
+	now := time.Now()
+	cached := &CachedResponse{
+		Status:  bw.status,
+		Header:  bw.header,
+		Body:    bw.body.Bytes(),
+		Created: now,
+		Expires: now.Add(c.ttl),
+	}
+	if !cacheable(cached) || (credentials && !sharedExplicitly(cached.Header)) {
+		return cached
+	}
+	vary := responseVary(cached.Header)
+	if len(vary) == 0 {
+		c.store.Set(primary, cached)
+		return cached
+	}
+	c.store.Set(primary, &CachedResponse{
+		Header:  http.Header{"Vary": {strings.Join(vary, ", ")}},
+		Created: now,
+		Expires: cached.Expires,
+	})
+	c.store.Set(primary+variantKey(r, vary), cached)
+	return cached
+}
+
+// revalidate refreshes a stale response in the background. Only one refresh per key is running.
+func (c *ResponseCache) revalidate(primary, key string, next http.Handler, r *http.Request, credentials bool) {
+	c.mutex.Lock()
+	if _, ok := c.refreshing[key]; ok {
+		c.mutex.Unlock()
+		return
+	}
+	c.refreshing[key] = struct{}{}
+	c.mutex.Unlock()
+	req := r.Clone(context.WithoutCancel(r.Context()))
+	go func() {
+		defer func() {
+			c.mutex.Lock()
+			delete(c.refreshing, key)
+			c.mutex.Unlock()
+			if rec := recover(); rec != nil {
+				boot.Logger.Error.Printf("revalidating cached response %s failed: %v", key, rec)
+			}
+		}()
+		c.fetch(primary, next, req, credentials)
+	}()
+}
+
+func (c *ResponseCache) write(w http.ResponseWriter, r *http.Request, cached *CachedResponse, state string) {
+	header := w.Header()
+	for key, values := range cached.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	header.Set("X-Cache", state)
+	if state != "MISS" {
+		header.Set("Age", strconv.Itoa(int(time.Since(cached.Created)/time.Second)))
+	}
+	w.WriteHeader(cached.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(cached.Body)
+	}
+}
+
+// cacheable accepts only successful responses, which don't forbid storing and don't set cookies,
+// which would be replayed to other clients. Responses varying on * can't be matched.
+func cacheable(cached *CachedResponse) bool {
+	if cached.Status != http.StatusOK || len(cached.Header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	for _, name := range responseVary(cached.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	directives := cacheDirectives(cached.Header)
+	return !directives["no-store"] && !directives["private"]
+}
+
+// sharedExplicitly returns true, if the response may be shared with other clients, even though
+// the request had credentials.
+func sharedExplicitly(header http.Header) bool {
+	directives := cacheDirectives(header)
+	return directives["public"] || directives["s-maxage"] || directives["must-revalidate"]
+}
+
+// cacheDirectives returns the names of the Cache-Control directives.
+func cacheDirectives(header http.Header) map[string]bool {
+	directives := make(map[string]bool)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(directive, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = true
+		}
+	}
+	return directives
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func cacheGet(handler http.Handler, path string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	var calls atomic.Int32
+	cache := NewResponseCache(ResponseCacheOptions{})
+	handler := cache.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		Render(w, r, http.StatusOK, []struct {
+			Symbol string `json:"symbol" csv:"symbol"`
+		}{{Symbol: "AAPL"}})
+	}))
+	json := cacheGet(handler, "/quotes", "Accept", "application/json")
+	csv := cacheGet(handler, "/quotes", "Accept", "text/csv")
+	if json.Header().Get("X-Cache") != "MISS" || csv.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("expected a miss per variant, got %q and %q", json.Header().Get("X-Cache"), csv.Header().Get("X-Cache"))
+	}
+	if w := cacheGet(handler, "/quotes", "Accept", "application/json"); w.Header().Get("X-Cache") != "HIT" || w.Body.String() != json.Body.String() {
+		t.Errorf("expected the json variant, got %q %s", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if w := cacheGet(handler, "/quotes", "Accept", "text/csv"); w.Header().Get("X-Cache") != "HIT" || w.Body.String() != csv.Body.String() {
+		t.Errorf("expected the csv variant, got %q %s", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 handler calls, got %d", calls.Load())
+	}
+	if n := cache.PurgePath("/quotes"); n != 3 {
+		t.Errorf("expected marker and both variants to be purged, got %d", n)
+	}
+}
+
+func TestResponseCacheVaryStar(t *testing.T) {
+	cache := NewResponseCache(ResponseCacheOptions{})
+	handler := cache.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "*")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	cacheGet(handler, "/")
+	if w := cacheGet(handler, "/"); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("responses varying on * must not be stored, got %q", w.Header().Get("X-Cache"))
+	}
+}
+
+func TestResponseCacheStreams(t *testing.T) {
+	cache := NewResponseCache(ResponseCacheOptions{})
+	handler := cache.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("event streams must get a flushable writer")
+		}
+	}))
+	if w := cacheGet(handler, "/events", "Accept", "text/event-stream"); w.Header().Get("X-Cache") != "" {
+		t.Errorf("event streams must bypass the cache, got %q", w.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,362 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/boot-go/boot"
+	"github.com/go-chi/chi/v5"
+)
+
+// errors
+var (
+	ErrRouterSealed          = errors.New("routes and middlewares can't be registered once the server is live")
+	ErrMiddlewareAfterRoutes = errors.New("all middlewares must be defined before routes")
+	ErrRouteRegistration     = errors.New("route registration failed")
+	ErrDuplicateRoute        = errors.New("route is already registered")
+)
+
+// routerSealedEvent is published after the RouterInitializedEvent. All handlers of the
+// RouterInitializedEvent are processed at this point, because the events are delivered in order.
+type routerSealedEvent struct{}
+
+// RegistrationError contains all failed registrations of routes and middlewares.
+type RegistrationError struct {
+	Errors []error
+}
+
+func (e *RegistrationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(len(e.Errors)) + " route registration(s) failed:")
+	for _, err := range e.Errors {
+		sb.WriteString("\n  - " + err.Error())
+	}
+	return sb.String()
+}
+
+func (e *RegistrationError) Unwrap() []error {
+	return e.Errors
+}
+
+// registrations keeps track of the router state and the registration errors.
+type registrations struct {
+	mutex  sync.Mutex
+	sealed bool
+	errors []error
+	done   chan struct{}
+}
+
+func newRegistrations() *registrations {
+	return &registrations{
+		done: make(chan struct{}),
+	}
+}
+
+func (reg *registrations) seal() {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if !reg.sealed {
+		reg.sealed = true
+		close(reg.done)
+	}
+}
+
+func (reg *registrations) isSealed() bool {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	return reg.sealed
+}
+
+func (reg *registrations) fail(err error) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	boot.Logger.Error.Printf("%v", err)
+	reg.errors = append(reg.errors, err)
+}
+
+// err returns all registration errors as RegistrationError.
+func (reg *registrations) err() error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if len(reg.errors) == 0 {
+		return nil
+	}
+	return &RegistrationError{Errors: append([]error(nil), reg.errors...)}
+}
+
+// guard executes the registration unless the router is sealed. Panics of chi are recovered and
+// recorded as errors instead. Every error names the component, which tried to register.
+func (reg *registrations) guard(operation string, register func()) (ok bool) {
+	if reg.isSealed() {
+		reg.fail(fmt.Errorf("%s: %s: %w", callerName(), operation, ErrRouterSealed))
+		return false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("%s: %s: %w: %v", callerName(), operation, ErrRouteRegistration, r)
+			if message, isString := r.(string); isString && strings.Contains(message, "middlewares must be defined before routes") {
+				err = fmt.Errorf("%s: %s: %w", callerName(), operation, ErrMiddlewareAfterRoutes)
+			}
+			reg.fail(err)
+			ok = false
+		}
+	}()
+	register()
+	return true
+}
+
+// guardRoute additionally rejects routes, which are already registered for the method.
+func (reg *registrations) guardRoute(router chi.Router, method, pattern string, register func()) bool {
+	operation := method + " " + pattern
+	if method == "" {
+		operation = "handle " + pattern
+		method = http.MethodGet
+	}
+	if !reg.isSealed() && router.Find(chi.NewRouteContext(), method, pattern) == pattern {
+		reg.fail(fmt.Errorf("%s: %s: %w", callerName(), operation, ErrDuplicateRoute))
+		return false
+	}
+	return reg.guard(operation, register)
+}
+
+// ignoredCallers are packages, which are skipped when looking for the registering component.
+var ignoredCallers = []string{
+	"github.com/boot-go/stack/server/chi.",
+	"github.com/go-chi/chi/",
+	"github.com/boot-go/boot.",
+	"reflect.",
+	"runtime.",
+}
+
+// callerName returns the qualified name of the component, which called the server. The
+// format is the same as of boot.QualifiedName, e.g. github.com/acme/quotes/component.
+func callerName() string {
+	const depth = 32
+	pcs := make([]uintptr, depth)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		ignored := false
+		for _, prefix := range ignoredCallers {
+			if strings.HasPrefix(frame.Function, prefix) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored && frame.Function != "" {
+			return qualifiedFunctionOwner(frame.Function)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// qualifiedFunctionOwner converts a function name like github.com/acme/quotes.(*component).Init
+// into github.com/acme/quotes/component. Functions without receiver are returned unchanged.
+func qualifiedFunctionOwner(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return function
+	}
+	pkg := function[:slash+1+dot]
+	rest := function[slash+1+dot+1:]
+	if !strings.HasPrefix(rest, "(") {
+		return function
+	}
+	end := strings.Index(rest, ")")
+	if end < 0 {
+		return function
+	}
+	receiver := strings.TrimPrefix(rest[1:end], "*")
+	if i := strings.Index(receiver, "["); i >= 0 {
+		receiver = receiver[:i]
+	}
+	return pkg + "/" + receiver
+}
+
+// guardedRouter is used by the server and passed with the RouterInitializedEvent. Registrations
+// after the server is live are rejected with ErrRouterSealed, misuse of chi is reported as
+// error instead of a panic. The server is only set for the root router.
+type guardedRouter struct {
+	chi.Router
+	reg    *registrations
+	server *server
+}
+
+var _ chi.Router = (*guardedRouter)(nil)
+
+func (g *guardedRouter) wrap(router chi.Router) chi.Router {
+	return &guardedRouter{Router: router, reg: g.reg}
+}
+
+func (g *guardedRouter) Use(middlewares ...func(http.Handler) http.Handler) {
+	g.reg.guard("use middleware", func() {
+		g.Router.Use(middlewares...)
+	})
+}
+
+func (g *guardedRouter) With(middlewares ...func(http.Handler) http.Handler) chi.Router {
+	router := chi.Router(g)
+	g.reg.guard("with middleware", func() {
+		router = g.wrap(g.Router.With(middlewares...))
+	})
+	return router
+}
+
+func (g *guardedRouter) Group(fn func(r chi.Router)) chi.Router {
+	router := chi.Router(g)
+	g.reg.guard("group", func() {
+		router = g.wrap(g.Router.Group(func(r chi.Router) {
+			fn(g.wrap(r))
+		}))
+	})
+	return router
+}
+
+func (g *guardedRouter) Route(pattern string, fn func(r chi.Router)) chi.Router {
+	router := chi.Router(g)
+	g.reg.guard("route "+pattern, func() {
+		router = g.wrap(g.Router.Route(pattern, func(r chi.Router) {
+			fn(g.wrap(r))
+		}))
+	})
+	return router
+}
+
+func (g *guardedRouter) Mount(pattern string, handler http.Handler) {
+	g.reg.guard("mount "+pattern, func() {
+		g.Router.Mount(pattern, handler)
+	})
+}
+
+func (g *guardedRouter) Handle(pattern string, handler http.Handler) {
+	g.reg.guardRoute(g.Router, "", pattern, func() {
+		g.Router.Handle(pattern, handler)
+	})
+}
+
+func (g *guardedRouter) HandleFunc(pattern string, handlerFunc http.HandlerFunc) {
+	g.reg.guardRoute(g.Router, "", pattern, func() {
+		g.Router.HandleFunc(pattern, handlerFunc)
+	})
+}
+
+func (g *guardedRouter) Method(method, pattern string, handler http.Handler) {
+	g.reg.guardRoute(g.Router, method, pattern, func() {
+		g.Router.Method(method, pattern, handler)
+	})
+}
+
+func (g *guardedRouter) MethodFunc(method, pattern string, handlerFunc http.HandlerFunc) {
+	g.reg.guardRoute(g.Router, method, pattern, func() {
+		g.Router.MethodFunc(method, pattern, handlerFunc)
+	})
+}
+
+func (g *guardedRouter) Connect(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodConnect, pattern, handlerFunc)
+}
+
+func (g *guardedRouter) Delete(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodDelete, pattern, handlerFunc)
+}
+
+func (g *guardedRouter) Get(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodGet, pattern, handlerFunc)
+}
+
+func (g *guardedRouter) Head(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodHead, pattern, handlerFunc)
+}
+
+func (g *guardedRouter) Options(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodOptions, pattern, handlerFunc)
+}
+
+func (g *guardedRouter) Patch(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodPatch, pattern, handlerFunc)
+}
+
+func (g *guardedRouter) Post(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodPost, pattern, handlerFunc)
+}
+
+func (g *guardedRouter) Put(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodPut, pattern, handlerFunc)
+}
+
+func (g *guardedRouter) Trace(pattern string, handlerFunc http.HandlerFunc) {
+	g.MethodFunc(http.MethodTrace, pattern, handlerFunc)
+}
+
+// NotFound replaces the fallback handler of the server for the root router. Sub routers count
+// their unmatched requests as well.
+func (g *guardedRouter) NotFound(handlerFunc http.HandlerFunc) {
+	g.reg.guard("not found handler", func() {
+		if g.server != nil {
+			g.server.notFound = handlerFunc
+			return
+		}
+		g.Router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			metrics.Add("unmatched_requests", 1)
+			handlerFunc(w, r)
+		})
+	})
+}
+
+func (g *guardedRouter) MethodNotAllowed(handlerFunc http.HandlerFunc) {
+	g.reg.guard("method not allowed handler", func() {
+		g.Router.MethodNotAllowed(handlerFunc)
+	})
+}
+
+// initializeRouter publishes the RouterInitializedEvent and waits until all handlers are
+// processed. Registration errors abort the start of the server.
+func (s *server) initializeRouter() error {
+	err := s.Eventbus.Publish(RouterInitializedEvent{Router: s.routes})
+	if err != nil {
+		return err
+	}
+	err = s.Eventbus.Publish(routerSealedEvent{})
+	if err != nil {
+		return err
+	}
+	select {
+	case <-s.registrations.done:
+	case err := <-s.shutdown:
+		s.signalShutdown(err)
+		return ErrRouterSealed
+	}
+	return s.registrations.err()
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+// Package servertest boots the chi server in unit test mode and provides fluent helpers to
+// send requests and verify responses.
+//
+//	h := servertest.Start(t, &myComponent{})
+//	h.GET("/quotes/AAPL").Do().Status(http.StatusOK).JSONPath("symbol", "AAPL")
+package servertest
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boot-go/boot"
+	"github.com/boot-go/stack/server/chi"
+)
+
+const (
+	startTimeout = 10 * time.Second
+	stopTimeout  = 10 * time.Second
+)
+
+// Harness runs a boot session with the chi server and the given components.
+type Harness struct {
+	t        testing.TB
+	session  *boot.Session
+	url      string
+	client   *http.Client
+	done     chan error
+	stopOnce sync.Once
+}
+
+// probe receives the started event of the server.
+type probe struct {
+	Eventbus boot.EventBus `boot:"wire"`
+	started  chan string
+}
+
+func (p *probe) Init() error {
+	return p.Eventbus.Subscribe(func(e chi.StartedEvent) {
+		p.started <- e.URL
+	})
+}
+
+// Start boots the server with the components under boot.UnitTestFlag and waits until it
+// accepts requests. The harness is stopped automatically when the test finishes.
+func Start(t testing.TB, components ...boot.Component) *Harness {
+	t.Helper()
+	session := boot.NewSession(boot.UnitTestFlag)
+	p := &probe{started: make(chan string, 1)}
+	factories := []func() boot.Component{
+		chi.NewComponent,
+		func() boot.Component { return p },
+	}
+	for _, component := range components {
+		component := component
+		factories = append(factories, func() boot.Component { return component })
+	}
+	for _, factory := range factories {
+		if err := session.Register(factory); err != nil {
+			t.Fatalf("failed to register component: %v", err)
+		}
+	}
+	h := &Harness{
+		t:       t,
+		session: session,
+		done:    make(chan error, 1),
+	}
+	go func() {
+		h.done <- session.Go()
+	}()
+	select {
+	case url := <-p.started:
+		h.url = url
+	case err := <-h.done:
+		if err == nil {
+			t.Fatalf("server stopped before it was started, the start error is logged")
+		}
+		t.Fatalf("server stopped before it was started: %v", err)
+	case <-time.After(startTimeout):
+		t.Fatalf("server not started within %s", startTimeout)
+	}
+	h.client = &http.Client{
+		Timeout: startTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	t.Cleanup(h.Stop)
+	return h
+}
+
+// URL returns the base url of the server.
+func (h *Harness) URL() string {
+	return h.url
+}
+
+// Client returns the client used for requests. Redirects aren't followed, so they can be
+// verified.
+func (h *Harness) Client() *http.Client {
+	return h.client
+}
+
+// Stop shuts the session down and waits until all components are stopped. It can be called
+// multiple times.
+func (h *Harness) Stop() {
+	h.stopOnce.Do(func() {
+		h.session.Shutdown()
+		select {
+		case err := <-h.done:
+			if err != nil {
+				h.t.Errorf("server stopped with error: %v", err)
+			}
+		case <-time.After(stopTimeout):
+			h.t.Errorf("server not stopped within %s", stopTimeout)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package servertest_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/boot-go/boot"
+	server "github.com/boot-go/stack/server/chi"
+	"github.com/boot-go/stack/server/chi/servertest"
+)
+
+// routes registers the routes of a test on the server.
+type routes struct {
+	Eventbus boot.EventBus `boot:"wire"`
+	Server   server.Server `boot:"wire"`
+	register func(s server.Server)
+}
+
+func (c *routes) Init() error {
+	return c.Eventbus.Subscribe(func(server.RouterInitializedEvent) {
+		c.register(c.Server)
+	})
+}
+
+// echo answers with the method, the query, the X-Test header and the body of the request.
+func echo(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Echo", r.Method)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"method": r.Method,
+		"query":  r.URL.Query(),
+		"header": r.Header.Get("X-Test"),
+		"type":   r.Header.Get("Content-Type"),
+		"body":   string(body),
+	})
+}
+
+func echoRoutes(s server.Server) {
+	s.HandleFunc("/echo", echo)
+}
+
+func TestHarness(t *testing.T) {
+	h := servertest.Start(t, &routes{register: echoRoutes})
+	if !strings.HasPrefix(h.URL(), "http://") {
+		t.Fatalf("expected the url of the server, got %s", h.URL())
+	}
+	response, err := h.Client().Get(h.URL() + "/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected the client to reach the server, got %d", response.StatusCode)
+	}
+	h.Stop()
+	h.Stop()
+	if _, err := h.Client().Get(h.URL() + "/echo"); err == nil {
+		t.Error("expected the server to be stopped")
+	}
+}
+
+func TestHarnessSealedRouter(t *testing.T) {
+	h := servertest.Start(t, &routes{register: func(s server.Server) {
+		s.Post("/register", func(w http.ResponseWriter, r *http.Request) {
+			s.Get("/late", echo)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}})
+	h.POST("/register").Do().Status(http.StatusNoContent)
+	// the route registered after the server is live is rejected and falls back to 404
+	h.GET("/late").Do().
+		Status(http.StatusNotFound).
+		HeaderContains("Content-Type", "application/problem+json").
+		JSONPath("status", http.StatusNotFound).
+		JSONPath("detail", "no route matches /late")
+}
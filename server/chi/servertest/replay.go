@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package servertest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/boot-go/stack/server/chi"
+)
+
+// ReplayFile replays all entries of the HAR file, e.g. downloaded from the chi.Recorder, and
+// verifies that each response has the recorded status.
+func (h *Harness) ReplayFile(path string) []*Response {
+	h.t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		h.t.Fatalf("failed to open HAR file %s: %v", path, err)
+	}
+	defer f.Close()
+	har, err := chi.ReadHAR(f)
+	if err != nil {
+		h.t.Fatalf("failed to read HAR file %s: %v", path, err)
+	}
+	return h.Replay(har)
+}
+
+// Replay sends all entries of the archive in order to the server and verifies that each
+// response has the recorded status. Redacted values are replayed as they were recorded.
+func (h *Harness) Replay(har *chi.HAR) []*Response {
+	h.t.Helper()
+	responses := make([]*Response, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		responses = append(responses, h.ReplayEntry(entry).Status(entry.Response.Status))
+	}
+	return responses
+}
+
+// ReplayEntry sends the recorded request to the server. Only the path and query of the
+// recorded url are used. Entries with a truncated request body can't be replayed and fail the
+// test.
+func (h *Harness) ReplayEntry(entry chi.HAREntry) *Response {
+	h.t.Helper()
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		h.t.Fatalf("invalid recorded url %s: %v", entry.Request.URL, err)
+	}
+	req := h.NewRequest(entry.Request.Method, u.EscapedPath())
+	req.query = u.Query()
+	for _, header := range entry.Request.Headers {
+		if !isHopHeader(header.Name) {
+			req.header.Add(header.Name, header.Value)
+		}
+	}
+	if postData := entry.Request.PostData; postData != nil {
+		if postData.Truncated {
+			h.t.Fatalf("recorded request body of %s %s is truncated and can't be replayed", entry.Request.Method, entry.Request.URL)
+		}
+		body, err := decode(postData.Text, postData.Encoding)
+		if err != nil {
+			h.t.Fatalf("invalid recorded request body of %s %s: %v", entry.Request.Method, entry.Request.URL, err)
+		}
+		req.Body(bytes.NewReader(body))
+	}
+	return req.Do()
+}
+
+// DecodedBody returns the recorded response body, which may be base64 encoded.
+func DecodedBody(content chi.HARContent) ([]byte, error) {
+	return decode(content.Text, content.Encoding)
+}
+
+func decode(text, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+// isHopHeader returns true for headers, which must not be replayed.
+func isHopHeader(name string) bool {
+	switch strings.ToLower(name) {
+	case "connection", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade", "te", "trailer", "host", "content-length", "accept-encoding":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package servertest_test
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	server "github.com/boot-go/stack/server/chi"
+	"github.com/boot-go/stack/server/chi/servertest"
+)
+
+var binary = []byte{0x00, 0xff, 0xfe, 0x01}
+
+// recordedRoutes records all requests except the download of the recordings.
+func recordedRoutes(recorder *server.Recorder) func(s server.Server) {
+	return func(s server.Server) {
+		s.Use(recorder.Handler)
+		s.HandleFunc("/echo", echo)
+		s.Get("/binary", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(binary)
+		})
+		s.HandleFunc("/admin/recordings", recorder.AdminHandler())
+	}
+}
+
+func newRecorder() *server.Recorder {
+	return server.NewRecorder(server.RecorderOptions{
+		Filter: func(r *http.Request) bool {
+			return !strings.HasPrefix(r.URL.Path, "/admin/")
+		},
+	})
+}
+
+func TestReplay(t *testing.T) {
+	recorder := newRecorder()
+	h := servertest.Start(t, &routes{register: recordedRoutes(recorder)})
+	h.POST("/echo").Query("symbol", "A B").Header("X-Test", "recorded").JSON(map[string]string{"symbol": "ACME"}).Do().Status(http.StatusOK)
+	h.GET("/binary").Do().Status(http.StatusOK)
+	h.DELETE("/missing").Do().Status(http.StatusNotFound)
+	har := recorder.HAR()
+	if len(har.Log.Entries) != 3 {
+		t.Fatalf("expected 3 recorded requests, got %d", len(har.Log.Entries))
+	}
+
+	responses := h.Replay(har)
+	if len(responses) != 3 {
+		t.Fatalf("expected a response per entry, got %d", len(responses))
+	}
+	responses[0].
+		JSONPath("method", http.MethodPost).
+		JSONPath("query.symbol", []string{"A B"}).
+		JSONPath("header", "recorded").
+		JSONPath("body", `{"symbol":"ACME"}`)
+	recorded, err := servertest.DecodedBody(har.Log.Entries[1].Response.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recorded, binary) || !bytes.Equal(responses[1].Bytes(), binary) {
+		t.Errorf("expected the binary body, recorded %x, replayed %x", recorded, responses[1].Bytes())
+	}
+}
+
+func TestReplayFile(t *testing.T) {
+	recorder := newRecorder()
+	h := servertest.Start(t, &routes{register: recordedRoutes(recorder)})
+	h.PUT("/echo").Body(strings.NewReader("plain")).Do()
+	h.GET("/missing").Do()
+	file := filepath.Join(t.TempDir(), "recordings.har")
+	download := h.GET("/admin/recordings").Do().Status(http.StatusOK)
+	if err := os.WriteFile(file, download.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	recorder.Clear()
+	responses := h.ReplayFile(file)
+	if len(responses) != 2 {
+		t.Fatalf("expected the responses of the recorded requests, got %d", len(responses))
+	}
+	responses[0].JSONPath("method", http.MethodPut).JSONPath("body", "plain")
+	if replayed := recorder.HAR().Log.Entries; len(replayed) != 2 || replayed[1].Request.Method != http.MethodGet {
+		t.Errorf("expected the requests to be replayed in order, got %+v", replayed)
+	}
+}
+
+func TestReplayFailures(t *testing.T) {
+	recorder := newRecorder()
+	tb := &recordingT{T: t}
+	h := servertest.Start(tb, &routes{register: recordedRoutes(recorder)})
+	h.GET("/echo").Do()
+	har := recorder.HAR()
+	har.Log.Entries[0].Response.Status = http.StatusCreated
+	h.Replay(har)
+	tb.expectErrors(t, "expected status 201, got 200")
+
+	entry := har.Log.Entries[0]
+	entry.Request.PostData = &server.HARPostData{Text: "partial", Truncated: true}
+	tb.fatal(func() { h.ReplayEntry(entry) })
+	tb.expectErrors(t, "is truncated and can't be replayed")
+	tb.fatal(func() { h.ReplayFile(filepath.Join(t.TempDir(), "missing.har")) })
+	tb.expectErrors(t, "failed to open HAR file")
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package servertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Request is built fluently and sent with Do.
+type Request struct {
+	h      *Harness
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   io.Reader
+}
+
+// NewRequest creates a request for the path relative to the server url.
+func (h *Harness) NewRequest(method, path string) *Request {
+	return &Request{
+		h:      h,
+		method: method,
+		path:   path,
+		query:  url.Values{},
+		header: http.Header{},
+	}
+}
+
+// GET creates a GET request.
+func (h *Harness) GET(path string) *Request {
+	return h.NewRequest(http.MethodGet, path)
+}
+
+// HEAD creates a HEAD request.
+func (h *Harness) HEAD(path string) *Request {
+	return h.NewRequest(http.MethodHead, path)
+}
+
+// POST creates a POST request.
+func (h *Harness) POST(path string) *Request {
+	return h.NewRequest(http.MethodPost, path)
+}
+
+// PUT creates a PUT request.
+func (h *Harness) PUT(path string) *Request {
+	return h.NewRequest(http.MethodPut, path)
+}
+
+// PATCH creates a PATCH request.
+func (h *Harness) PATCH(path string) *Request {
+	return h.NewRequest(http.MethodPatch, path)
+}
+
+// DELETE creates a DELETE request.
+func (h *Harness) DELETE(path string) *Request {
+	return h.NewRequest(http.MethodDelete, path)
+}
+
+// Header sets a request header.
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// Query adds a query parameter.
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Body sets the request body.
+func (r *Request) Body(body io.Reader) *Request {
+	r.body = body
+	return r
+}
+
+// JSON encodes the value as request body and sets the content type.
+func (r *Request) JSON(v any) *Request {
+	r.h.t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.h.t.Fatalf("failed to encode request body: %v", err)
+	}
+	r.header.Set("Content-Type", "application/json")
+	r.body = bytes.NewReader(body)
+	return r
+}
+
+// Do sends the request and returns the response for verification. The test fails
+// immediately, if the request can't be sent.
+func (r *Request) Do() *Response {
+	r.h.t.Helper()
+	target := strings.TrimSuffix(r.h.url, "/") + "/" + strings.TrimPrefix(r.path, "/")
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+	req, err := http.NewRequest(r.method, target, r.body)
+	if err != nil {
+		r.h.t.Fatalf("failed to create request %s %s: %v", r.method, r.path, err)
+	}
+	req.Header = r.header
+	resp, err := r.h.client.Do(req)
+	if err != nil {
+		r.h.t.Fatalf("failed to send request %s %s: %v", r.method, r.path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		r.h.t.Fatalf("failed to read response of %s %s: %v", r.method, r.path, err)
+	}
+	return &Response{
+		t:        r.h.t,
+		Response: resp,
+		body:     body,
+	}
+}
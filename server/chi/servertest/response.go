@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package servertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Response contains the received response and provides fluent assertions. Failed assertions
+// mark the test as failed, but don't stop it.
+type Response struct {
+	*http.Response
+	t    testing.TB
+	body []byte
+}
+
+// Bytes returns the response body.
+func (r *Response) Bytes() []byte {
+	return r.body
+}
+
+// String returns the response body as string.
+func (r *Response) String() string {
+	return string(r.body)
+}
+
+// Decode decodes the json response body into the value.
+func (r *Response) Decode(v any) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.body, v); err != nil {
+		r.t.Errorf("failed to decode response body: %v", err)
+	}
+	return r
+}
+
+// Status verifies the status code.
+func (r *Response) Status(expected int) *Response {
+	r.t.Helper()
+	if r.StatusCode != expected {
+		r.t.Errorf("expected status %d, got %d with body: %s", expected, r.StatusCode, r.body)
+	}
+	return r
+}
+
+// HasHeader verifies the header value.
+func (r *Response) HasHeader(key, expected string) *Response {
+	r.t.Helper()
+	if actual := r.Header.Get(key); actual != expected {
+		r.t.Errorf("expected header %s to be %q, got %q", key, expected, actual)
+	}
+	return r
+}
+
+// HeaderContains verifies that the header value contains the substring.
+func (r *Response) HeaderContains(key, substring string) *Response {
+	r.t.Helper()
+	if actual := r.Header.Get(key); !strings.Contains(actual, substring) {
+		r.t.Errorf("expected header %s to contain %q, got %q", key, substring, actual)
+	}
+	return r
+}
+
+// BodyContains verifies that the body contains the substring.
+func (r *Response) BodyContains(substring string) *Response {
+	r.t.Helper()
+	if !strings.Contains(string(r.body), substring) {
+		r.t.Errorf("expected body to contain %q, got: %s", substring, r.body)
+	}
+	return r
+}
+
+// JSONPath verifies the value at the path of the json body. The path uses dots for object
+// keys and brackets or dots for array indexes, e.g. quotes[0].symbol or quotes.0.symbol.
+// The expected value is compared after a json round trip, so numbers can be passed as int.
+func (r *Response) JSONPath(path string, expected any) *Response {
+	r.t.Helper()
+	actual, err := r.lookup(path)
+	if err != nil {
+		r.t.Errorf("json path %s: %v", path, err)
+		return r
+	}
+	normalized, err := normalize(expected)
+	if err != nil {
+		r.t.Errorf("json path %s: failed to normalize expected value: %v", path, err)
+		return r
+	}
+	if !reflect.DeepEqual(actual, normalized) {
+		r.t.Errorf("json path %s: expected %v, got %v", path, normalized, actual)
+	}
+	return r
+}
+
+// JSONPathExists verifies that the path exists in the json body.
+func (r *Response) JSONPathExists(path string) *Response {
+	r.t.Helper()
+	if _, err := r.lookup(path); err != nil {
+		r.t.Errorf("json path %s: %v", path, err)
+	}
+	return r
+}
+
+func (r *Response) lookup(path string) (any, error) {
+	var document any
+	if err := json.Unmarshal(r.body, &document); err != nil {
+		return nil, fmt.Errorf("body is not valid json: %w", err)
+	}
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	current := document
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			continue
+		}
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("key %s not found", segment)
+			}
+			current = value
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("index %s out of range", segment)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("segment %s can't be resolved on %v", segment, current)
+		}
+	}
+	return current, nil
+}
+
+func normalize(v any) (any, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	err = json.Unmarshal(encoded, &decoded)
+	return decoded, err
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package servertest_test
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/boot-go/stack/server/chi/servertest"
+)
+
+// recordingT records failed assertions instead of failing the test.
+type recordingT struct {
+	*testing.T
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// Fatalf records the failed assertion and stops the goroutine, see fatal.
+func (r *recordingT) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// fatal runs the function, which is expected to stop with Fatalf, in its own goroutine.
+func (r *recordingT) fatal(fn func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	<-done
+}
+
+// expectErrors verifies that the failed assertions contain the messages in order.
+func (r *recordingT) expectErrors(t *testing.T, messages ...string) {
+	t.Helper()
+	if len(r.errors) != len(messages) {
+		t.Fatalf("expected %d failed assertions, got %q", len(messages), r.errors)
+	}
+	for i, message := range messages {
+		if !strings.Contains(r.errors[i], message) {
+			t.Errorf("expected failed assertion %q to contain %q", r.errors[i], message)
+		}
+	}
+	r.errors = nil
+}
+
+func TestRequest(t *testing.T) {
+	h := servertest.Start(t, &routes{register: echoRoutes})
+	methods := map[string]func(string) *servertest.Request{
+		http.MethodGet:     h.GET,
+		http.MethodPost:    h.POST,
+		http.MethodPut:     h.PUT,
+		http.MethodPatch:   h.PATCH,
+		http.MethodDelete:  h.DELETE,
+		http.MethodOptions: func(path string) *servertest.Request { return h.NewRequest(http.MethodOptions, path) },
+	}
+	for method, request := range methods {
+		request("echo").Do().Status(http.StatusOK).JSONPath("method", method)
+	}
+	h.HEAD("/echo").Do().Status(http.StatusOK).HasHeader("X-Echo", http.MethodHead)
+	h.GET("/echo").
+		Query("symbol", "A").
+		Query("symbol", "B").
+		Header("X-Test", "header").
+		Do().
+		JSONPath("query.symbol", []string{"A", "B"}).
+		JSONPath("header", "header")
+	h.POST("/echo").Body(strings.NewReader("plain")).Do().JSONPath("body", "plain")
+	h.PUT("/echo").JSON(map[string]int{"amount": 1}).Do().
+		JSONPath("type", "application/json").
+		JSONPath("body", `{"amount":1}`)
+}
+
+func TestResponse(t *testing.T) {
+	h := servertest.Start(t, &routes{register: echoRoutes})
+	response := h.GET("/echo").Query("symbol", "A").Header("X-Test", "header").Do()
+	response.
+		Status(http.StatusOK).
+		HasHeader("X-Echo", http.MethodGet).
+		HeaderContains("Content-Type", "json").
+		BodyContains(`"method":"GET"`).
+		JSONPath("query.symbol[0]", "A").
+		JSONPath("query.symbol.0", "A").
+		JSONPathExists("query.symbol")
+	var decoded struct {
+		Method string `json:"method"`
+	}
+	response.Decode(&decoded)
+	if decoded.Method != http.MethodGet {
+		t.Errorf("expected the decoded body, got %+v", decoded)
+	}
+	if !strings.HasPrefix(response.String(), "{") || string(response.Bytes()) != response.String() {
+		t.Errorf("unexpected body %s", response.String())
+	}
+}
+
+func TestResponseFailures(t *testing.T) {
+	recorder := &recordingT{T: t}
+	h := servertest.Start(recorder, &routes{register: echoRoutes})
+	response := h.GET("/echo").Do()
+	response.Status(http.StatusCreated)
+	recorder.expectErrors(t, "expected status 201, got 200")
+	response.HasHeader("X-Echo", "POST").HeaderContains("X-Echo", "PUT")
+	recorder.expectErrors(t, `expected header X-Echo to be "POST"`, `expected header X-Echo to contain "PUT"`)
+	response.BodyContains("missing")
+	recorder.expectErrors(t, `expected body to contain "missing"`)
+	response.JSONPath("method", "POST").JSONPath("unknown", 1).JSONPath("method.0", 1).JSONPathExists("query.symbol[0]")
+	recorder.expectErrors(t, "expected POST, got GET", "key unknown not found", "segment 0 can't be resolved", "key symbol not found")
+	response.Decode(&[]string{})
+	recorder.expectErrors(t, "failed to decode response body")
+	h.HEAD("/echo").Do().JSONPathExists("method")
+	recorder.expectErrors(t, "body is not valid json")
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package servertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	updateFlag  = "update"
+	updateEnv   = "UPDATE_SNAPSHOTS"
+	snapshotDir = "testdata"
+	maskedValue = "<masked>"
+)
+
+// SnapshotOptions defines which parts of the response are recorded.
+type SnapshotOptions struct {
+	// Headers are recorded in addition to the status and the body.
+	Headers []string
+	// MaskHeaders are recorded with a masked value, e.g. request ids.
+	MaskHeaders []string
+	// MaskFields are json paths of volatile body fields, which are recorded with a masked
+	// value. A * matches every array element or object key, e.g. quotes.*.timestamp.
+	MaskFields []string
+	// Update writes the golden file instead of comparing it. The golden files are written as
+	// well, if the environment variable UPDATE_SNAPSHOTS is true or the test package defines
+	// an -update flag, which is set.
+	Update bool
+}
+
+// MatchSnapshot compares the response with the golden file testdata/<name>.golden. The golden
+// file is written instead, when an update is requested. JSON bodies are normalized, so the
+// key order and formatting don't matter.
+func (r *Response) MatchSnapshot(name string, opts SnapshotOptions) *Response {
+	r.t.Helper()
+	actual, err := r.snapshot(opts)
+	if err != nil {
+		r.t.Errorf("failed to create snapshot %s: %v", name, err)
+		return r
+	}
+	file := filepath.Join(snapshotDir, name+".golden")
+	if opts.Update || updating() {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			r.t.Fatalf("failed to create snapshot directory: %v", err)
+		}
+		if err := os.WriteFile(file, actual, 0o600); err != nil {
+			r.t.Fatalf("failed to write snapshot %s: %v", file, err)
+		}
+		return r
+	}
+	expected, err := os.ReadFile(file)
+	if err != nil {
+		r.t.Errorf("failed to read snapshot %s, run the test with %s=true to create it: %v", file, updateEnv, err)
+		return r
+	}
+	if !bytes.Equal(expected, actual) {
+		r.t.Errorf("response doesn't match snapshot %s, run the test with %s=true to accept it\n%s", file, updateEnv, diff(expected, actual))
+	}
+	return r
+}
+
+// updating returns true if the golden files should be written. The flag isn't registered by
+// this package, so test packages can define their own -update flag.
+func updating() bool {
+	if update, err := strconv.ParseBool(os.Getenv(updateEnv)); err == nil && update {
+		return true
+	}
+	f := flag.Lookup(updateFlag)
+	if f == nil {
+		return false
+	}
+	update, _ := strconv.ParseBool(f.Value.String())
+	return update
+}
+
+// snapshot renders the status, the selected headers and the normalized body.
+func (r *Response) snapshot(opts SnapshotOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("status: " + strconv.Itoa(r.StatusCode) + "\n")
+	headers := make(map[string]string)
+	for _, key := range opts.Headers {
+		if values := r.Header.Values(key); len(values) > 0 {
+			headers[http.CanonicalHeaderKey(key)] = strings.Join(values, ", ")
+		}
+	}
+	for _, key := range opts.MaskHeaders {
+		if r.Header.Get(key) != "" {
+			headers[http.CanonicalHeaderKey(key)] = maskedValue
+		}
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		buf.WriteString(key + ": " + headers[key] + "\n")
+	}
+	buf.WriteString("\n")
+	var document any
+	if len(r.body) == 0 || json.Unmarshal(r.body, &document) != nil {
+		buf.Write(r.body)
+	} else {
+		for _, field := range opts.MaskFields {
+			mask(document, strings.Split(strings.NewReplacer("[", ".", "]", "").Replace(field), "."))
+		}
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(document); err != nil {
+			return nil, err
+		}
+	}
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// mask replaces the values at the path in place.
+func mask(node any, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	segment, last := path[0], len(path) == 1
+	switch n := node.(type) {
+	case map[string]any:
+		for key, value := range n {
+			if segment != "*" && segment != key {
+				continue
+			}
+			if last {
+				n[key] = maskedValue
+			} else {
+				mask(value, path[1:])
+			}
+		}
+	case []any:
+		for i, value := range n {
+			if segment != "*" && segment != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				n[i] = maskedValue
+			} else {
+				mask(value, path[1:])
+			}
+		}
+	}
+}
+
+// diff returns the first differing line of both snapshots.
+func diff(expected, actual []byte) string {
+	expectedLines := strings.Split(string(expected), "\n")
+	actualLines := strings.Split(string(actual), "\n")
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var e, a string
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			a = actualLines[i]
+		}
+		if e != a {
+			return "line " + strconv.Itoa(i+1) + ":\n- " + e + "\n+ " + a
+		}
+	}
+	return ""
+}
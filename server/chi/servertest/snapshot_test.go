@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package servertest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	server "github.com/boot-go/stack/server/chi"
+	"github.com/boot-go/stack/server/chi/servertest"
+)
+
+// quoteRoutes answers with volatile headers and fields, which are masked in the snapshots.
+func quoteRoutes(s server.Server) {
+	s.Get("/quote", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "max-age=15")
+		w.Header().Set("X-Request-Id", strconv.FormatInt(now.UnixNano(), 10))
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"symbol": "ACME",
+			"price":  "189.30",
+			"time":   now,
+			"trades": []map[string]any{{"id": now.UnixNano(), "size": 100}, {"id": now.UnixNano() + 1, "size": 50}},
+		})
+	})
+	s.Get("/text", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("plain text"))
+	})
+}
+
+var quoteSnapshot = servertest.SnapshotOptions{
+	Headers:     []string{"Cache-Control", "X-Missing"},
+	MaskHeaders: []string{"X-Request-Id"},
+	MaskFields:  []string{"time", "trades[*].id"},
+}
+
+func TestMatchSnapshot(t *testing.T) {
+	h := servertest.Start(t, &routes{register: quoteRoutes})
+	h.GET("/quote").Do().MatchSnapshot("quote", quoteSnapshot)
+	h.GET("/text").Do().MatchSnapshot("text", servertest.SnapshotOptions{})
+}
+
+func TestMatchSnapshotUpdate(t *testing.T) {
+	dir := filepath.Join("testdata", "update")
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	h := servertest.Start(t, &routes{register: quoteRoutes})
+	opts := quoteSnapshot
+	opts.Update = true
+	h.GET("/quote").Do().MatchSnapshot("update/quote", opts)
+	written, err := os.ReadFile(filepath.Join(dir, "quote.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(filepath.Join("testdata", "quote.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != string(expected) {
+		t.Errorf("expected the snapshot to be written\n%s", written)
+	}
+}
+
+func TestMatchSnapshotFailures(t *testing.T) {
+	recorder := &recordingT{T: t}
+	h := servertest.Start(recorder, &routes{register: quoteRoutes})
+	h.GET("/quote").Do().MatchSnapshot("missing", quoteSnapshot)
+	recorder.expectErrors(t, "failed to read snapshot testdata/missing.golden")
+	h.GET("/quote").Do().MatchSnapshot("quote", servertest.SnapshotOptions{Headers: quoteSnapshot.Headers})
+	recorder.expectErrors(t, "response doesn't match snapshot testdata/quote.golden")
+}
@@ -0,0 +1,397 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSSEHeartbeat        = 15 * time.Second
+	defaultSSEHistory          = 100
+	defaultSSEHistoryRetention = 5 * time.Minute
+	defaultSSEBuffer           = 16
+)
+
+// SSEResetEvent is sent by the Broker instead of the missed events, when the Last-Event-ID of a
+// reconnecting client isn't in the history anymore. Clients should reload their state.
+const SSEResetEvent = "reset"
+
+// errors
+var (
+	ErrSSEUnsupported = errors.New("response writer doesn't support flushing")
+	ErrSSEClosed      = errors.New("event stream closed")
+	ErrSSEUnavailable = errors.New("event stream not available while shutting down")
+)
+
+// SSEEvent is a single server-sent event.
+type SSEEvent struct {
+	// ID is used by clients to resume with the Last-Event-ID header.
+	ID string
+	// Event is the event type, the default type is message.
+	Event string
+	// Data is split into multiple data lines, if it contains line breaks. An empty data line is
+	// sent for events without data, because browsers don't dispatch events without data.
+	Data string
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// SSEOptions configures an event stream.
+type SSEOptions struct {
+	// Retry is sent once when the stream is opened.
+	Retry time.Duration
+	// Heartbeat defines how often a comment is sent to keep the connection open. Defaults to
+	// 15 seconds.
+	Heartbeat time.Duration
+}
+
+// SSEStream writes server-sent events to a client. It is safe for concurrent use.
+type SSEStream struct {
+	w           http.ResponseWriter
+	flusher     http.Flusher
+	controller  *http.ResponseController
+	lastEventID string
+	mutex       sync.Mutex
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// openStream prepares the response for server-sent events.
+func openStream(w http.ResponseWriter, r *http.Request, opts SSEOptions) (*SSEStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, ErrSSEUnsupported
+	}
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = defaultSSEHeartbeat
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	stream := &SSEStream{
+		w:           w,
+		flusher:     flusher,
+		controller:  http.NewResponseController(w),
+		lastEventID: r.Header.Get("Last-Event-ID"),
+		done:        make(chan struct{}),
+	}
+	if opts.Retry > 0 {
+		_ = stream.Send(SSEEvent{Retry: opts.Retry})
+	} else {
+		flusher.Flush()
+	}
+	go stream.heartbeat(r, opts.Heartbeat)
+	return stream, nil
+}
+
+// LastEventID returns the id sent by a reconnecting client.
+func (s *SSEStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed when the client disconnects or the server is shutting down.
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send writes the event and flushes it to the client.
+func (s *SSEStream) Send(event SSEEvent) error {
+	var sb strings.Builder
+	if event.ID != "" {
+		sb.WriteString("id: " + stripLineBreaks(event.ID) + "\n")
+	}
+	if event.Event != "" {
+		sb.WriteString("event: " + stripLineBreaks(event.Event) + "\n")
+	}
+	if event.Retry > 0 {
+		sb.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+	// only the retry alone isn't an event
+	if event.Data != "" || event.ID != "" || event.Event != "" || event.Retry == 0 {
+		for _, line := range strings.Split(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\n") {
+			sb.WriteString("data: " + line + "\n")
+		}
+	}
+	sb.WriteString("\n")
+	return s.write(sb.String())
+}
+
+// Comment writes a comment, which is ignored by clients.
+func (s *SSEStream) Comment(comment string) error {
+	return s.write(": " + stripLineBreaks(comment) + "\n\n")
+}
+
+// Close ends the stream. Handlers must close the stream before returning and should return as
+// soon as Done is closed.
+func (s *SSEStream) Close() {
+	// the lock ensures that no write is in progress once Close returns
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.close()
+}
+
+// abort closes the stream during a write, which is blocked by a slow client. The expired write
+// deadline lets the write fail.
+func (s *SSEStream) abort() {
+	_ = s.controller.SetWriteDeadline(time.Now())
+	s.Close()
+}
+
+func (s *SSEStream) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *SSEStream) write(data string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-s.done:
+		return ErrSSEClosed
+	default:
+	}
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		s.close()
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *SSEStream) heartbeat(r *http.Request, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.Comment("heartbeat")
+		case <-r.Context().Done():
+			s.Close()
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func stripLineBreaks(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// Broker is a simple publish/subscribe broker for server-sent events. Published events are
+// kept in a history per topic, so reconnecting clients can resume with Last-Event-ID. Topics
+// without subscribers are removed including their history after the history retention.
+type Broker struct {
+	server           *server
+	mutex            sync.Mutex
+	historySize      int
+	historyRetention time.Duration
+	topics           map[string]*sseTopic
+}
+
+type sseTopic struct {
+	sequence    uint64
+	history     []SSEEvent
+	subscribers map[chan SSEEvent]struct{}
+	expiry      *time.Timer
+}
+
+func newBroker(s *server) *Broker {
+	return &Broker{
+		server:           s,
+		historySize:      defaultSSEHistory,
+		historyRetention: defaultSSEHistoryRetention,
+		topics:           make(map[string]*sseTopic),
+	}
+}
+
+func (b *Broker) topic(name string) *sseTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &sseTopic{subscribers: make(map[chan SSEEvent]struct{})}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Publish sends the event to all subscribers of the topic. Events without an id get a
+// sequential id assigned. Subscribers, which can't keep up, miss the event.
+func (b *Broker) Publish(topic string, event SSEEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	t := b.topic(topic)
+	t.sequence++
+	if event.ID == "" {
+		event.ID = strconv.FormatUint(t.sequence, 10)
+	}
+	t.history = append(t.history, event)
+	if len(t.history) > b.historySize {
+		t.history = t.history[len(t.history)-b.historySize:]
+	}
+	for subscriber := range t.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+	b.release(topic, t)
+}
+
+// Handler returns a handler, which streams all events of the topic to the client.
+func (b *Broker) Handler(topic string, opts SSEOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stream, err := b.server.Stream(w, r, opts)
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		events, missed := b.subscribe(topic, stream.LastEventID())
+		defer b.unsubscribe(topic, events)
+		for _, event := range missed {
+			if stream.Send(event) != nil {
+				return
+			}
+		}
+		for {
+			select {
+			case event := <-events:
+				if stream.Send(event) != nil {
+					return
+				}
+			case <-stream.Done():
+				return
+			}
+		}
+	}
+}
+
+// subscribe returns the subscription and all events published after the last event id. If the
+// event isn't in the history anymore, a reset event is returned instead.
+func (b *Broker) subscribe(topic string, lastEventID string) (chan SSEEvent, []SSEEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	t := b.topic(topic)
+	if t.expiry != nil {
+		t.expiry.Stop()
+		t.expiry = nil
+	}
+	events := make(chan SSEEvent, defaultSSEBuffer)
+	t.subscribers[events] = struct{}{}
+	if lastEventID == "" {
+		return events, nil
+	}
+	for i, event := range t.history {
+		if event.ID == lastEventID {
+			return events, append([]SSEEvent(nil), t.history[i+1:]...)
+		}
+	}
+	reset := SSEEvent{Event: SSEResetEvent, Data: "events after " + stripLineBreaks(lastEventID) + " are not available"}
+	if len(t.history) > 0 {
+		// the client resumes after the latest event on the next reconnect
+		reset.ID = t.history[len(t.history)-1].ID
+	}
+	return events, []SSEEvent{reset}
+}
+
+func (b *Broker) unsubscribe(topic string, events chan SSEEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	t, ok := b.topics[topic]
+	if !ok {
+		return
+	}
+	delete(t.subscribers, events)
+	b.release(topic, t)
+}
+
+// release removes the topic without subscribers once its history has expired. The retention
+// starts again with every published event.
+func (b *Broker) release(name string, t *sseTopic) {
+	if len(t.subscribers) > 0 {
+		return
+	}
+	if t.expiry != nil {
+		t.expiry.Stop()
+		t.expiry = nil
+	}
+	if len(t.history) == 0 {
+		delete(b.topics, name)
+		return
+	}
+	var expiry *time.Timer
+	expiry = time.AfterFunc(b.historyRetention, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if t.expiry == expiry && b.topics[name] == t {
+			delete(b.topics, name)
+		}
+	})
+	t.expiry = expiry
+}
+
+// streams tracks all open event streams, so they can be closed on shutdown.
+type streams struct {
+	mutex sync.Mutex
+	open  map[*SSEStream]struct{}
+}
+
+func (s *streams) add(stream *SSEStream) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.open == nil {
+		s.open = make(map[*SSEStream]struct{})
+	}
+	s.open[stream] = struct{}{}
+	go func() {
+		<-stream.Done()
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		delete(s.open, stream)
+	}()
+}
+
+// closeAll aborts the open streams. They are closed outside of the lock, because closing waits for
+// pending writes.
+func (s *streams) closeAll() {
+	s.mutex.Lock()
+	open := make([]*SSEStream, 0, len(s.open))
+	for stream := range s.open {
+		open = append(open, stream)
+	}
+	s.mutex.Unlock()
+	for _, stream := range open {
+		stream.abort()
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSSESend(t *testing.T) {
+	tests := []struct {
+		name  string
+		event SSEEvent
+		want  string
+	}{
+		{"data", SSEEvent{Data: "a"}, "data: a\n\n"},
+		{"multiline data", SSEEvent{Data: "a\r\nb\nc"}, "data: a\ndata: b\ndata: c\n\n"},
+		{"all fields", SSEEvent{ID: "1", Event: "quote", Data: "a", Retry: time.Second}, "id: 1\nevent: quote\nretry: 1000\ndata: a\n\n"},
+		{"id without data", SSEEvent{ID: "1"}, "id: 1\ndata: \n\n"},
+		{"event without data", SSEEvent{Event: "ping"}, "event: ping\ndata: \n\n"},
+		{"empty event", SSEEvent{}, "data: \n\n"},
+		{"retry only", SSEEvent{Retry: 2 * time.Second}, "retry: 2000\n\n"},
+		{"line breaks in fields", SSEEvent{ID: "1\n2", Event: "a\r\nb", Data: "c"}, "id: 12\nevent: ab\ndata: c\n\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			w := httptest.NewRecorder()
+			stream, err := openStream(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), SSEOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+			if err := stream.Send(test.event); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Body.String(); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSSECloseAllSlowClient(t *testing.T) {
+	var open streams
+	var sent atomic.Int64
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		stream, err := openStream(w, r, SSEOptions{})
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		open.add(stream)
+		event := SSEEvent{Data: strings.Repeat("x", 64<<10)}
+		for stream.Send(event) == nil {
+			sent.Add(1)
+		}
+	}))
+	defer server.Close()
+
+	// the client never reads, so the writes block once the socket buffers are full
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for previous := int64(-1); ; {
+		time.Sleep(50 * time.Millisecond)
+		current := sent.Load()
+		if current > 0 && current == previous {
+			break
+		}
+		previous = current
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		open.closeAll()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected closing the streams not to wait for the blocked write")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the handler to return")
+	}
+}
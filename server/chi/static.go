@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boot-go/boot"
+	"github.com/go-chi/chi/v5"
+)
+
+// StaticOptions configures how files are served by Server.Static.
+type StaticOptions struct {
+	// Index is the file served for directories. Defaults to index.html.
+	Index string
+	// CachePolicy is applied to all files except the index file, which is always revalidated.
+	CachePolicy CachePolicy
+	// Precompressed serves .br and .gz variants of a file, if the client accepts them.
+	Precompressed bool
+	// SPA serves the index file for unknown paths without a file extension, so client side
+	// routing of single page applications works.
+	SPA bool
+}
+
+// staticHandler serves files from a fs.FS, which can be an embed.FS or os.DirFS.
+type staticHandler struct {
+	fsys  fs.FS
+	opts  StaticOptions
+	etags sync.Map
+}
+
+// precompressed encodings in order of preference
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func newStaticHandler(fsys fs.FS, opts StaticOptions) *staticHandler {
+	if opts.Index == "" {
+		opts.Index = "index.html"
+	}
+	return &staticHandler{
+		fsys: fsys,
+		opts: opts,
+	}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Clean("/" + chi.URLParam(r, "*"))[1:]
+	if name == "" {
+		name = h.opts.Index
+	} else if info, err := fs.Stat(h.fsys, name); err == nil && info.IsDir() {
+		name = path.Join(name, h.opts.Index)
+	}
+	if _, err := fs.Stat(h.fsys, name); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			boot.Logger.Error.Printf("failed to access static file %s: %v", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !h.opts.SPA || path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = h.opts.Index
+	}
+	h.serveFile(w, r, name)
+}
+
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	header := w.Header()
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if path.Base(name) == h.opts.Index {
+		header.Set("Cache-Control", CachePolicy{NoCache: true}.String())
+	} else if policy := h.opts.CachePolicy.String(); policy != "" {
+		header.Set("Cache-Control", policy)
+	}
+	file := name
+	if h.opts.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		accepted := r.Header.Get("Accept-Encoding")
+		for _, variant := range precompressedEncodings {
+			if !acceptsEncoding(accepted, variant.encoding) {
+				continue
+			}
+			if info, err := fs.Stat(h.fsys, name+variant.extension); err == nil && !info.IsDir() {
+				file = name + variant.extension
+				header.Set("Content-Encoding", variant.encoding)
+				break
+			}
+		}
+	}
+	content, modTime, err := h.open(file)
+	if err != nil {
+		boot.Logger.Error.Printf("failed to read static file %s: %v", file, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if closer, ok := content.(io.Closer); ok {
+		defer closer.Close()
+	}
+	etag, err := h.etag(file, content, modTime)
+	if err != nil {
+		boot.Logger.Error.Printf("failed to calculate etag for static file %s: %v", file, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	header.Set("ETag", etag)
+	// ServeContent handles conditional and range requests
+	http.ServeContent(w, r, name, modTime, content)
+}
+
+// open returns a seekable file. Files of a fs.FS which aren't seekable are read into memory.
+func (h *staticHandler) open(name string) (io.ReadSeeker, time.Time, error) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, time.Time{}, err
+	}
+	if seeker, ok := f.(io.ReadSeeker); ok {
+		return seeker, info.ModTime(), nil
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return bytes.NewReader(content), info.ModTime(), nil
+}
+
+// etag calculates a strong entity tag of the content. The tag is cached per file, size and
+// modification time, so it is calculated only once for embedded files.
+func (h *staticHandler) etag(name string, content io.ReadSeeker, modTime time.Time) (string, error) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	key := name + "|" + strconv.FormatInt(size, 10) + "|" + strconv.FormatInt(modTime.UnixNano(), 10)
+	if etag, ok := h.etags.Load(key); ok {
+		_, err = content.Seek(0, io.SeekStart)
+		return etag.(string), err
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	h.etags.Store(key, etag)
+	return etag, nil
+}
+
+// acceptsEncoding checks the Accept-Encoding header for the encoding, ignoring q=0 entries.
+func acceptsEncoding(accepted, encoding string) bool {
+	for _, part := range strings.Split(accepted, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(name), encoding) {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boot-go/boot"
+)
+
+// Timeout returns a middleware, which cancels the request context after the timeout and answers
+// with a problem response of the given status. Use http.StatusServiceUnavailable for handlers
+// doing own work and http.StatusGatewayTimeout for handlers waiting on upstream services. The
+// response of the handler is buffered, so writes after the timeout are discarded safely and the
+// handler can't interfere with the problem response. Responses larger than 1MB, e.g. file
+// downloads, are written directly once the limit is reached and are only cut off after the
+// timeout. WebSocket upgrades and event streams are long-lived and passed through without
+// timeout, as are all requests if the timeout isn't positive.
+func Timeout(timeout time.Duration, status int) func(http.Handler) http.Handler {
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if streamingRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+			tw := &timeoutWriter{w: w, header: make(http.Header), status: http.StatusOK}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mutex.Lock()
+				defer tw.mutex.Unlock()
+				if tw.streaming {
+					return
+				}
+				header := w.Header()
+				for key, values := range tw.header {
+					header[key] = values
+				}
+				w.WriteHeader(tw.status)
+				_, _ = w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mutex.Lock()
+				defer tw.mutex.Unlock()
+				tw.timedOut = true
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					boot.Logger.Warn.Printf("request %s %s timed out after %s", r.Method, r.URL.Path, timeout)
+					if !tw.streaming {
+						WriteProblem(w, r, NewProblem(status, "request timed out after "+timeout.String()))
+					}
+				}
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// streamingRequest returns true for WebSocket upgrades and event streams, which require an
+// unbuffered response writer.
+func streamingRequest(r *http.Request) bool {
+	if headerContainsToken(r.Header, "Connection", "upgrade") {
+		return true
+	}
+	for _, value := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(value, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// timeoutBufferSize is the limit of the buffered response, larger responses are streamed.
+const timeoutBufferSize = 1 << 20
+
+// timeoutWriter buffers the response of the handler until it completes in time or exceeds the
+// buffer size.
+type timeoutWriter struct {
+	mutex       sync.Mutex
+	w           http.ResponseWriter
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+	streaming   bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.status = status
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	if !tw.streaming && tw.body.Len()+len(b) > timeoutBufferSize {
+		tw.stream()
+	}
+	if tw.streaming {
+		return tw.w.Write(b)
+	}
+	return tw.body.Write(b)
+}
+
+// stream writes the buffered response, all further writes are passed through. It must be
+// called while locked.
+func (tw *timeoutWriter) stream() {
+	tw.streaming = true
+	header := tw.w.Header()
+	for key, values := range tw.header {
+		header[key] = values
+	}
+	tw.w.WriteHeader(tw.status)
+	_, _ = tw.w.Write(tw.body.Bytes())
+	tw.body.Reset()
+}
@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boot-go/boot"
+	"github.com/go-chi/chi/v5"
+)
+
+// Deprecation describes when a version was deprecated and when it will be removed. The link
+// refers to a migration guide and is optional.
+type Deprecation struct {
+	Since  time.Time
+	Sunset time.Time
+	Link   string
+}
+
+// APIVersion describes a registered version for introspection.
+type APIVersion struct {
+	Name        string
+	Default     bool
+	Deprecation *Deprecation
+	Routes      []string
+}
+
+type versionContextKey struct{}
+
+// RequestVersion returns the API version selected for the request or an empty string for
+// unversioned routes.
+func RequestVersion(r *http.Request) string {
+	version, _ := r.Context().Value(versionContextKey{}).(string)
+	return version
+}
+
+// versions keeps track of the registered API versions in the order of registration.
+type versions struct {
+	mutex        sync.RWMutex
+	names        []string
+	routers      map[string]chi.Router
+	deprecations map[string]Deprecation
+	header       string
+	fallback     string
+}
+
+func newVersions(header, fallback string) *versions {
+	return &versions{
+		routers:      make(map[string]chi.Router),
+		deprecations: make(map[string]Deprecation),
+		header:       header,
+		fallback:     fallback,
+	}
+}
+
+func (v *versions) add(version string, router chi.Router) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if _, ok := v.routers[version]; ok {
+		return
+	}
+	v.names = append(v.names, version)
+	v.routers[version] = router
+}
+
+// router returns the router of the version.
+func (v *versions) router(version string) (chi.Router, bool) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	router, ok := v.routers[version]
+	return router, ok
+}
+
+// matchAny returns true, if any version has a route for the method and path.
+func (v *versions) matchAny(method, path string) bool {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	for _, router := range v.routers {
+		if router.Match(chi.NewRouteContext(), method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *versions) empty() bool {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return len(v.names) == 0
+}
+
+func (v *versions) deprecate(version string, deprecation Deprecation) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.deprecations[version] = deprecation
+}
+
+func (v *versions) known(version string) bool {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	for _, name := range v.names {
+		if name == version {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultVersion returns the configured default or the first registered version.
+func (v *versions) defaultVersion() string {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	if v.fallback != "" || len(v.names) == 0 {
+		return v.fallback
+	}
+	return v.names[0]
+}
+
+func (v *versions) deprecation(version string) (Deprecation, bool) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	deprecation, ok := v.deprecations[version]
+	return deprecation, ok
+}
+
+// normalizeVersion accepts versions with and without the v prefix, e.g. 2 and v2.
+func normalizeVersion(version string) string {
+	version = strings.ToLower(strings.TrimSpace(version))
+	if version == "" || strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+// requested returns the version requested by header or the version parameter of the Accept
+// media type.
+func (v *versions) requested(r *http.Request) string {
+	if v.header != "" {
+		if version := r.Header.Get(v.header); version != "" {
+			return normalizeVersion(version)
+		}
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			_, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+			if version, ok := params["version"]; ok {
+				return normalizeVersion(version)
+			}
+		}
+	}
+	return ""
+}
+
+// versionMiddleware is used by the router of the version. It adds the version to the request
+// context and the version headers to the response.
+func (s *server) versionMiddleware(version string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			s.writeVersionHeaders(w, version)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionContextKey{}, version)))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// serveVersion serves an unmatched request without version prefix with the requested or the
+// default version, if the version has a route for it. Requests for unknown versions are only
+// rejected, when a version has the route. It returns false, when the request isn't served.
+func (s *server) serveVersion(w http.ResponseWriter, r *http.Request) bool {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || s.versions.empty() {
+		return false
+	}
+	path := r.URL.Path
+	if r.URL.RawPath != "" {
+		path = r.URL.RawPath
+	}
+	if s.versions.known(strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]) {
+		// the version has no route for the prefixed request
+		return false
+	}
+	// the response depends on the requested version, even if it is a 404
+	s.writeVary(w)
+	requested := s.versions.requested(r)
+	version := requested
+	if version == "" {
+		version = s.versions.defaultVersion()
+	}
+	router, ok := s.versions.router(version)
+	if !ok || !router.Match(chi.NewRouteContext(), r.Method, path) {
+		if requested != "" && !ok && s.versions.matchAny(r.Method, path) {
+			WriteProblem(w, r, NewProblem(http.StatusBadRequest, "unsupported API version "+requested))
+			return true
+		}
+		return false
+	}
+	rctx.Reset()
+	rctx.Routes = s.router
+	rctx.RoutePath = path
+	router.ServeHTTP(w, r)
+	return true
+}
+
+// writeVersionHeaders adds the selected version and the deprecation headers of RFC 9745 and
+// RFC 8594 to the response.
+func (s *server) writeVersionHeaders(w http.ResponseWriter, version string) {
+	s.writeVary(w)
+	if s.versions.header != "" {
+		w.Header().Set(s.versions.header, version)
+	}
+	deprecation, ok := s.versions.deprecation(version)
+	if !ok {
+		return
+	}
+	if deprecation.Since.IsZero() {
+		w.Header().Set("Deprecation", "?1")
+	} else {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(deprecation.Since.Unix(), 10))
+	}
+	if !deprecation.Sunset.IsZero() {
+		w.Header().Set("Sunset", deprecation.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if deprecation.Link != "" {
+		w.Header().Add("Link", "<"+deprecation.Link+">; rel=\"deprecation\"")
+	}
+}
+
+// writeVary adds the headers selecting the version to the Vary header, so caches keep the
+// responses of the versions apart.
+func (s *server) writeVary(w http.ResponseWriter) {
+	if s.versions.header != "" {
+		addVary(w.Header(), s.versions.header, "Accept")
+	} else {
+		addVary(w.Header(), "Accept")
+	}
+}
+
+// Version registers the routes of an API version below the version prefix, e.g. /v2. The
+// routes are also served without prefix, when the version is requested by header or Accept
+// media type, or when it is the default version. Unversioned routes take precedence and ignore
+// the requested version.
+func (s *server) Version(version string, fn func(r chi.Router)) chi.Router {
+	version = normalizeVersion(version)
+	boot.Logger.Debug.Printf("attaching version %s", version)
+	router := s.routes.Route("/"+version, func(r chi.Router) {
+		r.Use(s.versionMiddleware(version))
+		fn(r)
+	})
+	if router == s.routes {
+		// the registration failed and is reported as registration error
+		return router
+	}
+	s.versions.add(version, router)
+	return router
+}
+
+// DeprecateVersion marks the version as deprecated. Responses of the version contain the
+// Deprecation and Sunset headers.
+func (s *server) DeprecateVersion(version string, deprecation Deprecation) {
+	version = normalizeVersion(version)
+	boot.Logger.Debug.Printf("deprecating version %s", version)
+	s.versions.deprecate(version, deprecation)
+}
+
+// Versions returns all registered versions with their routes.
+func (s *server) Versions() []APIVersion {
+	routes := make(map[string][]string)
+	_ = chi.Walk(s.router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		segment := strings.SplitN(strings.TrimPrefix(route, "/"), "/", 2)[0]
+		routes[segment] = append(routes[segment], method+" "+route)
+		return nil
+	})
+	fallback := s.versions.defaultVersion()
+	s.versions.mutex.RLock()
+	defer s.versions.mutex.RUnlock()
+	result := make([]APIVersion, 0, len(s.versions.names))
+	for _, name := range s.versions.names {
+		version := APIVersion{
+			Name:    name,
+			Default: name == fallback,
+			Routes:  routes[name],
+		}
+		if deprecation, ok := s.versions.deprecations[name]; ok {
+			version.Deprecation = &deprecation
+		}
+		sort.Strings(version.Routes)
+		result = append(result, version)
+	}
+	return result
+}
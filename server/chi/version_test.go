@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi_test
+
+import (
+	"net/http"
+	"testing"
+
+	server "github.com/boot-go/stack/server/chi"
+	"github.com/boot-go/stack/server/chi/servertest"
+	"github.com/go-chi/chi/v5"
+)
+
+func versionedRoutes(s server.Server) {
+	s.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	for _, version := range []string{"v1", "v2"} {
+		version := version
+		s.Version(version, func(r chi.Router) {
+			r.Get("/quotes", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(version + ":" + server.RequestVersion(r)))
+			})
+		})
+	}
+}
+
+func TestVersionSelection(t *testing.T) {
+	h := servertest.Start(t, &routes{register: versionedRoutes})
+	h.GET("/quotes").Do().Status(http.StatusOK).BodyContains("v1:v1").HasHeader("API-Version", "v1")
+	h.GET("/quotes").Header("API-Version", "2").Do().Status(http.StatusOK).BodyContains("v2:v2")
+	h.GET("/quotes").Header("Accept", "application/json; version=2").Do().Status(http.StatusOK).BodyContains("v2:v2")
+	h.GET("/v2/quotes").Do().Status(http.StatusOK).BodyContains("v2:v2")
+	h.GET("/quotes").Header("API-Version", "v9").Do().Status(http.StatusBadRequest)
+	h.GET("/health").Header("API-Version", "v9").Do().Status(http.StatusOK)
+}
+
+func TestVersionVary(t *testing.T) {
+	h := servertest.Start(t, &routes{register: versionedRoutes})
+	for _, path := range []string{"/quotes", "/v1/quotes", "/unknown"} {
+		response := h.GET(path).Do()
+		vary := response.Header.Values("Vary")
+		if len(vary) != 2 || vary[0] != "Api-Version" || vary[1] != "Accept" {
+			t.Errorf("GET %s: expected Vary of the version headers, got %q", path, vary)
+		}
+	}
+	if vary := h.GET("/health").Do().Header.Get("Vary"); vary != "" {
+		t.Errorf("unversioned routes must not vary, got %q", vary)
+	}
+}
+
+func TestVersionAfterSeal(t *testing.T) {
+	var s server.Server
+	servertest.Start(t, &routes{register: func(srv server.Server) {
+		s = srv
+		versionedRoutes(srv)
+	}})
+	s.Version("v3", func(r chi.Router) {})
+	if versions := s.Versions(); len(versions) != 2 {
+		t.Errorf("rejected versions must not be registered, got %v", versions)
+	}
+}
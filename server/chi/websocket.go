@@ -0,0 +1,586 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // required by RFC 6455
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/boot-go/boot"
+)
+
+// WebSocket message types as defined by RFC 6455.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// WebSocket close codes as defined by RFC 6455.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	websocketGUID                = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	defaultWebSocketPingInterval = 30 * time.Second
+	defaultWebSocketPongWait     = 60 * time.Second
+	defaultWebSocketWriteTimeout = 10 * time.Second
+	defaultWebSocketMessageSize  = 1 << 20
+	defaultWebSocketSendQueue    = 64
+	defaultWebSocketReceiveQueue = 64
+)
+
+// errors
+var (
+	ErrWebSocketHandshake   = errors.New("websocket handshake failed")
+	ErrWebSocketOrigin      = errors.New("websocket origin not allowed")
+	ErrWebSocketClosed      = errors.New("websocket connection closed")
+	ErrWebSocketProtocol    = errors.New("websocket protocol error")
+	ErrWebSocketTooBig      = errors.New("websocket message too big")
+	ErrWebSocketEncoding    = errors.New("websocket text is not valid utf-8")
+	ErrWebSocketSlowReader  = errors.New("websocket send queue is full")
+	ErrWebSocketSlowWriter  = errors.New("websocket receive queue is full")
+	ErrWebSocketUnavailable = errors.New("websocket upgrade not available while shutting down")
+)
+
+// WebSocketOptions configures a single WebSocket connection.
+type WebSocketOptions struct {
+	// Subprotocols supported by the server in order of preference.
+	Subprotocols []string
+	// CheckOrigin returns true if the request origin is allowed. Defaults to same host only.
+	CheckOrigin func(r *http.Request) bool
+	// PingInterval defines how often pings are sent to the client. Defaults to 30 seconds.
+	PingInterval time.Duration
+	// PongWait defines how long to wait for any frame of the client before the connection is
+	// considered dead. Defaults to 60 seconds.
+	PongWait time.Duration
+	// WriteTimeout is the write deadline of every frame. Defaults to 10 seconds.
+	WriteTimeout time.Duration
+	// MaxMessageSize limits the size of a received message. Defaults to 1MB.
+	MaxMessageSize int64
+	// SendQueue is the amount of messages which can be queued before the connection is
+	// closed as slow reader. Defaults to 64.
+	SendQueue int
+	// ReceiveQueue is the amount of received messages, which are buffered until ReadMessage is
+	// called. If the queue is full, the connection is closed with a policy violation. Defaults
+	// to 64.
+	ReceiveQueue int
+}
+
+func (o *WebSocketOptions) defaults() {
+	if o.CheckOrigin == nil {
+		o.CheckOrigin = sameOrigin
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = defaultWebSocketPingInterval
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = defaultWebSocketPongWait
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = defaultWebSocketWriteTimeout
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = defaultWebSocketMessageSize
+	}
+	if o.SendQueue <= 0 {
+		o.SendQueue = defaultWebSocketSendQueue
+	}
+	if o.ReceiveQueue <= 0 {
+		o.ReceiveQueue = defaultWebSocketReceiveQueue
+	}
+}
+
+// sameOrigin accepts requests without origin or where the origin host matches the request host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+type wsFrame struct {
+	opcode  byte
+	payload []byte
+}
+
+type wsMessage struct {
+	messageType int
+	payload     []byte
+}
+
+// WebSocketConn is an upgraded WebSocket connection. Writes are queued and sent by a separate
+// goroutine, so they never block the caller. Frames are read by another goroutine, which
+// answers pings and detects dead clients, so connections which only send messages don't need
+// to call ReadMessage.
+type WebSocketConn struct {
+	id          string
+	subprotocol string
+	request     *http.Request
+	conn        net.Conn
+	reader      *bufio.Reader
+	opts        WebSocketOptions
+	hub         *Hub
+	send        chan wsFrame
+	closing     chan wsFrame
+	closeQueued atomic.Bool
+	messages    chan wsMessage
+	readErr     error
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+var websocketIDs atomic.Uint64
+
+// upgradeWebSocket performs the opening handshake and hijacks the connection. The connection is
+// added to the hub before its goroutines are started.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, opts WebSocketOptions, hub *Hub) (*WebSocketConn, error) {
+	opts.defaults()
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, ErrWebSocketHandshake
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, http.StatusText(http.StatusUpgradeRequired), http.StatusUpgradeRequired)
+		return nil, ErrWebSocketHandshake
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, ErrWebSocketHandshake
+	}
+	if !opts.CheckOrigin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, ErrWebSocketOrigin
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, ErrWebSocketHandshake
+	}
+	subprotocol := selectSubprotocol(r, opts.Subprotocols)
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	var response strings.Builder
+	response.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	response.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		response.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	response.WriteString("\r\n")
+	_ = conn.SetWriteDeadline(time.Now().Add(opts.WriteTimeout))
+	if _, err := conn.Write([]byte(response.String())); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+	c := &WebSocketConn{
+		id:          strconv.FormatUint(websocketIDs.Add(1), 10),
+		subprotocol: subprotocol,
+		request:     r,
+		conn:        conn,
+		reader:      rw.Reader,
+		opts:        opts,
+		hub:         hub,
+		send:        make(chan wsFrame, opts.SendQueue),
+		closing:     make(chan wsFrame, 1),
+		messages:    make(chan wsMessage, opts.ReceiveQueue),
+		done:        make(chan struct{}),
+	}
+	if hub != nil {
+		hub.add(c)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+	go c.writeLoop()
+	go c.readLoop()
+	return c, nil
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID)) //nolint:gosec // required by RFC 6455
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func selectSubprotocol(r *http.Request, supported []string) string {
+	requested := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	for _, protocol := range supported {
+		for _, candidate := range requested {
+			if strings.TrimSpace(candidate) == protocol {
+				return protocol
+			}
+		}
+	}
+	return ""
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, candidate := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(candidate), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ID returns the unique id of the connection.
+func (c *WebSocketConn) ID() string {
+	return c.id
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Request returns the request, which was upgraded.
+func (c *WebSocketConn) Request() *http.Request {
+	return c.request
+}
+
+// Done is closed as soon as the connection is closed.
+func (c *WebSocketConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Join adds the connection to a room of the hub.
+func (c *WebSocketConn) Join(room string) {
+	if c.hub != nil {
+		c.hub.join(c, room)
+	}
+}
+
+// Leave removes the connection from a room of the hub.
+func (c *WebSocketConn) Leave(room string) {
+	if c.hub != nil {
+		c.hub.leave(c, room)
+	}
+}
+
+// WriteMessage queues a text or binary message. If the send queue is full, the connection is
+// closed, because the client isn't able to keep up.
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return ErrWebSocketProtocol
+	}
+	select {
+	case <-c.done:
+		return ErrWebSocketClosed
+	default:
+	}
+	select {
+	case c.send <- wsFrame{opcode: byte(messageType), payload: data}:
+		return nil
+	case <-c.done:
+		return ErrWebSocketClosed
+	default:
+		c.Close(CloseGoingAway, "slow reader")
+		return ErrWebSocketSlowReader
+	}
+}
+
+// ReadMessage returns the next text or binary message. Control frames are processed
+// internally. An error is returned when the connection is closed and all received messages
+// are read.
+func (c *WebSocketConn) ReadMessage() (int, []byte, error) {
+	message, ok := <-c.messages
+	if !ok {
+		return 0, nil, c.readErr
+	}
+	return message.messageType, message.payload, nil
+}
+
+// readLoop queues all received messages for ReadMessage until the connection is closed. The
+// read deadline is extended with every frame, so a client, which stopped answering pings, is
+// terminated.
+func (c *WebSocketConn) readLoop() {
+	defer close(c.messages)
+	for {
+		messageType, message, err := c.nextMessage()
+		if err == nil {
+			select {
+			case c.messages <- wsMessage{messageType: messageType, payload: message}:
+				continue
+			default:
+				err = c.fail(ClosePolicyViolation, ErrWebSocketSlowWriter)
+			}
+		}
+		select {
+		case <-c.done:
+			err = ErrWebSocketClosed
+		default:
+		}
+		c.readErr = err
+		if c.closeQueued.Load() {
+			// the write loop terminates the connection after the close frame is sent
+			<-c.done
+		}
+		c.terminate(err)
+		return
+	}
+}
+
+// nextMessage reads frames until a text or binary message is complete. Control frames are
+// processed on the way.
+func (c *WebSocketConn) nextMessage() (int, []byte, error) {
+	var messageType byte
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.opts.PongWait))
+		switch opcode {
+		case PingMessage:
+			c.control(PongMessage, payload)
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			code := CloseNormalClosure
+			switch {
+			case len(payload) == 1:
+				return 0, nil, c.fail(CloseProtocolError, ErrWebSocketProtocol)
+			case len(payload) >= 2:
+				code = int(binary.BigEndian.Uint16(payload))
+				if !validCloseCode(code) {
+					return 0, nil, c.fail(CloseProtocolError, ErrWebSocketProtocol)
+				}
+				if !utf8.Valid(payload[2:]) {
+					return 0, nil, c.fail(CloseInvalidFramePayloadData, ErrWebSocketEncoding)
+				}
+			}
+			c.Close(code, "")
+			return 0, nil, ErrWebSocketClosed
+		case 0:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, ErrWebSocketProtocol)
+			}
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, ErrWebSocketProtocol)
+			}
+			messageType = opcode
+		default:
+			return 0, nil, c.fail(CloseProtocolError, ErrWebSocketProtocol)
+		}
+		if int64(len(message)+len(payload)) > c.opts.MaxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, ErrWebSocketTooBig)
+		}
+		message = append(message, payload...)
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(message) {
+				return 0, nil, c.fail(CloseInvalidFramePayloadData, ErrWebSocketEncoding)
+			}
+			return int(messageType), message, nil
+		}
+	}
+}
+
+// validCloseCode returns true for the codes, which may be sent in a close frame. The reserved
+// codes 1004, 1005, 1006 and 1015 must not be sent, see RFC 6455 section 7.4.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+// readFrame reads a single frame. Frames sent by clients must be masked.
+func (c *WebSocketConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0f
+	if head[0]&0x70 != 0 || head[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, ErrWebSocketProtocol)
+	}
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if opcode >= CloseMessage && (length > 125 || !fin) {
+		return false, 0, nil, c.fail(CloseProtocolError, ErrWebSocketProtocol)
+	}
+	if length < 0 || length > c.opts.MaxMessageSize {
+		return false, 0, nil, c.fail(CloseMessageTooBig, ErrWebSocketTooBig)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Close sends a close frame with the given code and closes the connection afterwards.
+func (c *WebSocketConn) Close(code int, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	select {
+	case c.closing <- wsFrame{opcode: CloseMessage, payload: payload}:
+		c.closeQueued.Store(true)
+	default:
+	}
+}
+
+func (c *WebSocketConn) fail(code int, err error) error {
+	c.Close(code, err.Error())
+	return err
+}
+
+func (c *WebSocketConn) control(opcode byte, payload []byte) {
+	select {
+	case c.send <- wsFrame{opcode: opcode, payload: payload}:
+	default:
+	}
+}
+
+// writeLoop sends all queued frames and pings the client periodically.
+func (c *WebSocketConn) writeLoop() {
+	ticker := time.NewTicker(c.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case frame := <-c.send:
+			if err := c.writeFrame(frame); err != nil {
+				c.terminate(err)
+				return
+			}
+		case <-ticker.C:
+			if err := c.writeFrame(wsFrame{opcode: PingMessage}); err != nil {
+				c.terminate(err)
+				return
+			}
+		case frame := <-c.closing:
+			// flush pending messages before the close frame
+			for pending := len(c.send); pending > 0; pending-- {
+				if err := c.writeFrame(<-c.send); err != nil {
+					break
+				}
+			}
+			_ = c.writeFrame(frame)
+			c.terminate(ErrWebSocketClosed)
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *WebSocketConn) writeFrame(frame wsFrame) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | frame.opcode
+	length := len(frame.payload)
+	switch {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout)); err != nil {
+		return err
+	}
+	buffers := net.Buffers{header, frame.payload}
+	_, err := buffers.WriteTo(c.conn)
+	return err
+}
+
+// terminate closes the underlying connection and removes it from the hub.
+func (c *WebSocketConn) terminate(err error) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+		if c.hub != nil {
+			c.hub.remove(c)
+		}
+		if err != nil && !errors.Is(err, ErrWebSocketClosed) && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+			boot.Logger.Debug.Printf("websocket connection %s terminated: %v", c.id, err)
+		}
+	})
+}
@@ -0,0 +1,296 @@
+/*
+ * Copyright (c) 2021-2023 boot-go
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ */
+
+package chi_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	server "github.com/boot-go/stack/server/chi"
+	"github.com/boot-go/stack/server/chi/servertest"
+)
+
+// wsClient is a minimal client speaking the frames of RFC 6455, so malformed frames can be sent.
+type wsClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, h *servertest.Harness, path string) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(h.URL(), "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_, _ = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: " + conn.RemoteAddr().String() + "\r\n" +
+		"Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake failed: %s %v", response.Status, response.Header)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &wsClient{t: t, conn: conn, reader: reader}
+}
+
+func (c *wsClient) write(fin bool, opcode byte, payload []byte, masked bool) {
+	c.t.Helper()
+	head := []byte{opcode, 0}
+	if fin {
+		head[0] |= 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		head[1] = byte(len(payload))
+	case len(payload) <= 0xffff:
+		head[1] = 126
+		head = binary.BigEndian.AppendUint16(head, uint16(len(payload)))
+	default:
+		head[1] = 127
+		head = binary.BigEndian.AppendUint64(head, uint64(len(payload)))
+	}
+	data := append([]byte(nil), payload...)
+	if masked {
+		head[1] |= 0x80
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		head = append(head, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(head, data...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) send(opcode byte, payload string) {
+	c.t.Helper()
+	c.write(true, opcode, []byte(payload), true)
+}
+
+func (c *wsClient) close(code int, reason string) {
+	c.t.Helper()
+	c.write(true, server.CloseMessage, append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...), true)
+}
+
+// read returns the next frame of the server, which must not be masked.
+func (c *wsClient) read() (byte, []byte) {
+	c.t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		c.t.Fatalf("failed to read frame: %v", err)
+	}
+	if head[1]&0x80 != 0 {
+		c.t.Fatal("server frames must not be masked")
+	}
+	length := int(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, _ = io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, _ = io.ReadFull(c.reader, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		c.t.Fatalf("failed to read payload: %v", err)
+	}
+	return head[0] & 0x0f, payload
+}
+
+// expect reads frames until one with the opcode is received, pings of the server are skipped.
+func (c *wsClient) expect(opcode byte) []byte {
+	c.t.Helper()
+	for {
+		got, payload := c.read()
+		if got == opcode {
+			return payload
+		}
+		if got != server.PingMessage {
+			c.t.Fatalf("expected opcode %d, got %d with %q", opcode, got, payload)
+		}
+	}
+}
+
+// expectClose verifies the close code of the server and that the connection is closed afterwards.
+func (c *wsClient) expectClose(code int) {
+	c.t.Helper()
+	payload := c.expect(server.CloseMessage)
+	if len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != code {
+		c.t.Fatalf("expected close code %d, got %v", code, payload)
+	}
+	if _, err := c.reader.ReadByte(); err == nil {
+		c.t.Fatal("expected the connection to be closed after the close frame")
+	}
+}
+
+// startEcho starts a server, which echoes all messages received at /echo.
+func startEcho(t *testing.T, opts server.WebSocketOptions) (*servertest.Harness, *server.Hub) {
+	var hub *server.Hub
+	h := servertest.Start(t, &routes{register: func(s server.Server) {
+		hub = s.Hub()
+		s.Get("/echo", func(w http.ResponseWriter, r *http.Request) {
+			conn, err := s.Upgrade(w, r, opts)
+			if err != nil {
+				return
+			}
+			for {
+				messageType, message, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				_ = conn.WriteMessage(messageType, message)
+			}
+		})
+	}})
+	return h, hub
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	h, hub := startEcho(t, server.WebSocketOptions{})
+	c := dialWebSocket(t, h, "/echo")
+	c.send(server.TextMessage, "hello")
+	if payload := c.expect(server.TextMessage); string(payload) != "hello" {
+		t.Errorf("expected hello, got %q", payload)
+	}
+	large := bytes.Repeat([]byte{0xff}, 70000)
+	c.write(true, server.BinaryMessage, large, true)
+	if payload := c.expect(server.BinaryMessage); !bytes.Equal(payload, large) {
+		t.Errorf("expected the binary message of %d bytes, got %d", len(large), len(payload))
+	}
+	if hub.Count() != 1 {
+		t.Errorf("expected the connection in the hub, got %d", hub.Count())
+	}
+}
+
+func TestWebSocketUnmaskedFrame(t *testing.T) {
+	h, _ := startEcho(t, server.WebSocketOptions{})
+	c := dialWebSocket(t, h, "/echo")
+	c.write(true, server.TextMessage, []byte("hello"), false)
+	c.expectClose(server.CloseProtocolError)
+}
+
+func TestWebSocketFragmentedMessage(t *testing.T) {
+	h, _ := startEcho(t, server.WebSocketOptions{})
+	c := dialWebSocket(t, h, "/echo")
+	c.write(false, server.TextMessage, []byte("hel"), true)
+	c.write(true, server.PingMessage, []byte("between"), true)
+	c.write(false, 0, []byte("l"), true)
+	c.write(true, 0, []byte("o"), true)
+	if payload := c.expect(server.PongMessage); string(payload) != "between" {
+		t.Errorf("expected the pong of the interleaved ping, got %q", payload)
+	}
+	if payload := c.expect(server.TextMessage); string(payload) != "hello" {
+		t.Errorf("expected the reassembled message, got %q", payload)
+	}
+	c.write(true, 0, []byte("orphan"), true)
+	c.expectClose(server.CloseProtocolError)
+}
+
+func TestWebSocketPingPong(t *testing.T) {
+	h, hub := startEcho(t, server.WebSocketOptions{PingInterval: 20 * time.Millisecond, PongWait: 200 * time.Millisecond})
+	c := dialWebSocket(t, h, "/echo")
+	c.send(server.PingMessage, "ping")
+	if payload := c.expect(server.PongMessage); string(payload) != "ping" {
+		t.Errorf("expected the ping payload, got %q", payload)
+	}
+	if opcode, _ := c.read(); opcode != server.PingMessage {
+		t.Errorf("expected a ping of the server, got %d", opcode)
+	}
+	// the client stops answering, so the server terminates the connection
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.Count() != 0 {
+		t.Error("expected the dead connection to be removed from the hub")
+	}
+}
+
+func TestWebSocketCloseHandshake(t *testing.T) {
+	h, hub := startEcho(t, server.WebSocketOptions{})
+	c := dialWebSocket(t, h, "/echo")
+	c.close(server.CloseGoingAway, "bye")
+	c.expectClose(server.CloseGoingAway)
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.Count() != 0 {
+		t.Error("expected the closed connection to be removed from the hub")
+	}
+}
+
+func TestWebSocketInvalidClose(t *testing.T) {
+	h, _ := startEcho(t, server.WebSocketOptions{})
+	for _, code := range []int{999, 1004, 1005, 1006, 1015, 2000, 5000} {
+		c := dialWebSocket(t, h, "/echo")
+		c.close(code, "")
+		c.expectClose(server.CloseProtocolError)
+	}
+	c := dialWebSocket(t, h, "/echo")
+	c.close(server.CloseNormalClosure, "\xff")
+	c.expectClose(server.CloseInvalidFramePayloadData)
+}
+
+func TestWebSocketInvalidText(t *testing.T) {
+	h, _ := startEcho(t, server.WebSocketOptions{})
+	c := dialWebSocket(t, h, "/echo")
+	c.write(false, server.TextMessage, []byte{0xe2, 0x82}, true)
+	c.write(true, 0, []byte{0xac}, true)
+	if payload := c.expect(server.TextMessage); string(payload) != "€" {
+		t.Errorf("expected a character split across fragments, got %q", payload)
+	}
+	c.write(true, server.TextMessage, []byte{0xff, 0xfe}, true)
+	c.expectClose(server.CloseInvalidFramePayloadData)
+}
+
+func TestWebSocketOversizedMessage(t *testing.T) {
+	h, _ := startEcho(t, server.WebSocketOptions{MaxMessageSize: 16})
+	c := dialWebSocket(t, h, "/echo")
+	c.send(server.TextMessage, strings.Repeat("x", 17))
+	c.expectClose(server.CloseMessageTooBig)
+
+	c = dialWebSocket(t, h, "/echo")
+	c.write(false, server.TextMessage, bytes.Repeat([]byte("x"), 10), true)
+	c.write(true, 0, bytes.Repeat([]byte("x"), 10), true)
+	c.expectClose(server.CloseMessageTooBig)
+}